@@ -2,15 +2,22 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/config"
 	"github.com/mAmineChniti/StoryHub/internal/database"
 	"github.com/mAmineChniti/StoryHub/internal/server"
+	"github.com/mAmineChniti/StoryHub/internal/users"
 )
 
 func gracefulShutdown(apiServer *http.Server, done chan bool, stopCleanup chan struct{}) {
@@ -40,32 +47,153 @@ func gracefulShutdown(apiServer *http.Server, done chan bool, stopCleanup chan s
 	done <- true
 }
 
+// runConsistencyCheck prints the consistency report as JSON and exits with
+// status 1 when it found problems that were left unrepaired.
+func runConsistencyCheck(db database.Service, repair bool) {
+	report, err := db.CheckConsistency(context.Background(), repair)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+	if !report.Consistent() && !report.Repaired {
+		os.Exit(1)
+	}
+}
+
+// runCleanup runs orphan cleanup once and logs the outcome.
+func runCleanup(ctx context.Context, db database.Service, opts database.CleanupOptions) {
+	report, err := db.CleanupOrphanedStories(ctx, opts)
+	switch {
+	case err != nil:
+		if ctx.Err() == nil {
+			log.Printf("Orphaned stories cleanup error: %v", err)
+		}
+	case report.Aborted:
+		log.Printf("Orphaned stories cleanup aborted: %s", report.AbortReason)
+	case report.DryRun:
+		log.Printf("Orphaned stories cleanup dry run: would remove %d stories and %d collaborators of %d orphaned owners",
+			len(report.Stories), len(report.CollaboratorRemovals), len(report.OrphanedOwners))
+	case len(report.OrphanedOwners) > 0:
+		log.Printf("Orphaned stories cleanup removed %d stories and %d collaborators of %d orphaned owners",
+			len(report.Stories), len(report.CollaboratorRemovals), len(report.OrphanedOwners))
+	}
+}
+
+// runPurge permanently deletes the stories whose time in the trash is up.
+func runPurge(ctx context.Context, db database.Service, retention time.Duration) {
+	purged, err := db.PurgeTrash(ctx, retention)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Trash purge error: %v", err)
+		}
+	} else if purged > 0 {
+		log.Printf("Purged %d stories from the trash", purged)
+	}
+}
+
 func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	printConfig := flag.Bool("print-config", false, "print the configuration with secrets redacted and exit")
+	checkConsistency := flag.Bool("check-consistency", false, "report what half-applied forks and deletes left behind and exit")
+	repair := flag.Bool("repair", false, "with --check-consistency, also repair what it finds")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if *printConfig && cfg != nil {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *printConfig {
+		return
+	}
 
-	server := server.NewServer()
+	serverConfig := server.Config{
+		Port:                cfg.Port,
+		JWTSecret:           []byte(cfg.JWTSecret),
+		Debug:               cfg.Debug,
+		EditorsEditMetadata: cfg.EditorsEditMetadata,
+		Cleanup: database.CleanupOptions{
+			DryRun:           cfg.Cleanup.DryRun,
+			MaxOrphanedShare: cfg.Cleanup.MaxOrphanedShare,
+		},
+		TrashRetention: cfg.Trash.Retention,
+	}
+	for _, hex := range cfg.Admins {
+		adminID, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			log.Fatal(err)
+		}
+		serverConfig.Admins = append(serverConfig.Admins, adminID)
+	}
+	directory, err := users.New(cfg.Users)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbService := database.New(cfg.Database, directory)
+	if *checkConsistency {
+		runConsistencyCheck(dbService, *repair)
+		return
+	}
+
+	_, handler := server.New(serverConfig, dbService, server.SystemClock{}, nil)
+	server := server.NewHTTPServer(serverConfig, handler)
 
 	log.Println("Server is running on port: ", server.Addr)
 
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
 
-	// Start periodic orphaned stories cleanup
-	dbService := database.New()
+	// Background jobs run under ctx so that closing stopCleanup also
+	// abandons whatever database work they have in flight.
 	stopCleanup := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
-		ticker := time.NewTicker(6 * time.Hour)
+		<-stopCleanup
+		cancel()
+	}()
+
+	// Start periodic orphaned stories cleanup and trash purging
+	go func() {
+		ticker := time.NewTicker(cfg.Cleanup.Interval)
 		defer ticker.Stop()
 
 		// Initial cleanup
-		if err := dbService.CleanupOrphanedStories(); err != nil {
-			log.Printf("Initial orphaned stories cleanup error: %v", err)
+		runCleanup(ctx, dbService, serverConfig.Cleanup)
+		runPurge(ctx, dbService, serverConfig.TrashRetention)
+
+		for {
+			select {
+			case <-ticker.C:
+				runCleanup(ctx, dbService, serverConfig.Cleanup)
+				runPurge(ctx, dbService, serverConfig.TrashRetention)
+			case <-stopCleanup:
+				return
+			}
 		}
+	}()
+
+	// Start publishing scheduled stories as their time comes
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
-				if err := dbService.CleanupOrphanedStories(); err != nil {
-					log.Printf("Periodic orphaned stories cleanup error: %v", err)
+				published, err := dbService.PublishScheduledStories(ctx)
+				if err != nil {
+					log.Printf("Scheduled publishing error: %v", err)
+				} else if published > 0 {
+					log.Printf("Published %d scheduled stories", published)
 				}
 			case <-stopCleanup:
 				return
@@ -76,7 +204,7 @@ func main() {
 	// Run graceful shutdown in a separate goroutine
 	go gracefulShutdown(server, done, stopCleanup)
 
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
 		panic(fmt.Sprintf("http server error: %s", err))
 	}
@@ -0,0 +1,540 @@
+// Package config loads StoryHub's settings from built-in defaults, an
+// optional YAML file and the environment, later sources overriding earlier
+// ones, and checks them before anything starts.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DriverMongo  = "mongo"
+	DriverMemory = "memory"
+
+	DriverHTTP   = "http"
+	DriverStatic = "static"
+)
+
+// redacted replaces secrets in printed configurations.
+const redacted = "[redacted]"
+
+type Config struct {
+	Port int `yaml:"port"`
+	// Debug logs every request and response body.
+	Debug     bool   `yaml:"debug"`
+	JWTSecret string `yaml:"jwt_secret"`
+	// EditorsEditMetadata lets editors change a story's title, genre and
+	// description, which otherwise only its owner can.
+	EditorsEditMetadata bool `yaml:"editors_edit_metadata"`
+	// Admins lists the IDs of the users allowed to use the admin endpoints.
+	Admins   []string `yaml:"admins"`
+	Database Database `yaml:"database"`
+	Users    Users    `yaml:"users"`
+	Cleanup  Cleanup  `yaml:"cleanup"`
+	Trash    Trash    `yaml:"trash"`
+}
+
+type Database struct {
+	// Driver selects the store: DriverMongo or DriverMemory.
+	Driver string `yaml:"driver"`
+	// URI is a complete mongodb:// or mongodb+srv:// connection string.
+	// Without it one is built as mongodb+srv://Username:Password followed
+	// by ConnectionString. Username and Password still apply to a URI that
+	// carries no credentials of its own.
+	URI              string `yaml:"uri"`
+	Username         string `yaml:"username"`
+	Password         string `yaml:"password"`
+	ConnectionString string `yaml:"connection_string"`
+	AuthSource       string `yaml:"auth_source"`
+
+	Name        string      `yaml:"name"`
+	Collections Collections `yaml:"collections"`
+
+	// TLS turns on TLS even when the URI does not ask for it. TLSCAFile is a
+	// PEM bundle trusted in place of the system roots.
+	TLS       bool   `yaml:"tls"`
+	TLSCAFile string `yaml:"tls_ca_file"`
+
+	// Zero leaves the driver's default pool settings in place.
+	MaxPoolSize     uint64        `yaml:"max_pool_size"`
+	MinPoolSize     uint64        `yaml:"min_pool_size"`
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time"`
+
+	Timeouts Timeouts `yaml:"timeouts"`
+}
+
+// Timeouts bound how long the database layer waits on each kind of work, on
+// top of any deadline the caller's context already carries.
+type Timeouts struct {
+	// Operation bounds every single Service call made for a request.
+	Operation time.Duration `yaml:"operation"`
+	// Background bounds one run of a periodic job such as orphan cleanup or
+	// scheduled publishing.
+	Background time.Duration `yaml:"background"`
+	// Startup bounds creating indexes when the service starts.
+	Startup time.Duration `yaml:"startup"`
+}
+
+// Users configures the user directory that orphan cleanup asks whether story
+// owners still exist.
+type Users struct {
+	// Driver selects the directory: DriverHTTP asks the user service and
+	// DriverStatic answers from Existing.
+	Driver string `yaml:"driver"`
+	// BaseURL is the user service's API root. Lookups are POSTed to
+	// BaseURL/users/lookup in batches of BatchSize.
+	BaseURL string `yaml:"base_url"`
+	// ServiceToken is sent as a bearer token on every lookup.
+	ServiceToken string        `yaml:"service_token"`
+	BatchSize    int           `yaml:"batch_size"`
+	Timeout      time.Duration `yaml:"timeout"`
+	// Existing lists the IDs of the users the static directory knows about;
+	// it reports every other user as deleted.
+	Existing []string `yaml:"existing"`
+}
+
+// Cleanup configures the periodic removal of stories whose owners no longer
+// exist.
+type Cleanup struct {
+	Interval time.Duration `yaml:"interval"`
+	// DryRun only reports what each run would remove.
+	DryRun bool `yaml:"dry_run"`
+	// MaxOrphanedShare is the largest share of story owners, from 0 to 1,
+	// that may look orphaned before a run is aborted without removing
+	// anything. 1 turns the check off.
+	MaxOrphanedShare float64 `yaml:"max_orphaned_share"`
+}
+
+// Trash configures how long deleted stories can be restored. They are purged
+// for good on the cleanup interval once Retention has passed.
+type Trash struct {
+	Retention time.Duration `yaml:"retention"`
+}
+
+// Collections names the MongoDB collections each kind of record lives in.
+type Collections struct {
+	StoryDetails   string `yaml:"story_details"`
+	StoryContent   string `yaml:"story_content"`
+	StoryRevisions string `yaml:"story_revisions"`
+	StoryChapters  string `yaml:"story_chapters"`
+	MergeRequests  string `yaml:"merge_requests"`
+}
+
+// Default returns the configuration used for anything no source sets.
+func Default() Config {
+	return Config{
+		Port: 8080,
+		Database: Database{
+			Driver: DriverMongo,
+			Name:   "storyhub",
+			Collections: Collections{
+				StoryDetails:   "storydetails",
+				StoryContent:   "storycontent",
+				StoryRevisions: "storyrevisions",
+				StoryChapters:  "storychapters",
+				MergeRequests:  "mergerequests",
+			},
+			Timeouts: Timeouts{
+				Operation:  5 * time.Second,
+				Background: 30 * time.Second,
+				Startup:    10 * time.Second,
+			},
+		},
+		Users: Users{
+			Driver:    DriverHTTP,
+			BaseURL:   "https://gordian.onrender.com/api/v1",
+			BatchSize: 100,
+			Timeout:   10 * time.Second,
+		},
+		Cleanup: Cleanup{
+			Interval:         6 * time.Hour,
+			MaxOrphanedShare: 0.2,
+		},
+		Trash: Trash{
+			Retention: 30 * 24 * time.Hour,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path
+// when path is not empty, and the environment, which includes a .env file
+// in the working directory if there is one. Variables already set in the
+// environment take precedence over .env.
+//
+// When the result is invalid Load returns it along with the error, so it
+// can still be printed.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading .env: %v", err)
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, cfg.Validate()
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening config file: %v", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("error reading config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides settings with the environment variables that are set
+// and not empty.
+func (c *Config) loadEnv() error {
+	var errs []error
+
+	lookup := func(name string) (string, bool) {
+		value := os.Getenv(name)
+		return value, value != ""
+	}
+	setString := func(name string, dst *string) {
+		if value, ok := lookup(name); ok {
+			*dst = value
+		}
+	}
+
+	if value, ok := lookup("PORT"); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("PORT must be a number, got %q", value))
+		}
+		c.Port = port
+	}
+	if value, ok := lookup("DEBUG"); ok {
+		debug, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DEBUG must be true or false, got %q", value))
+		}
+		c.Debug = debug
+	}
+	if value, ok := lookup("EDITORS_EDIT_METADATA"); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("EDITORS_EDIT_METADATA must be true or false, got %q", value))
+		}
+		c.EditorsEditMetadata = enabled
+	}
+	setDuration := func(name string, dst *time.Duration) {
+		if value, ok := lookup(name); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a duration such as 5m, got %q", name, value))
+			}
+			*dst = d
+		}
+	}
+	setUint := func(name string, dst *uint64) {
+		if value, ok := lookup(name); ok {
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a whole number, got %q", name, value))
+			}
+			*dst = n
+		}
+	}
+	setString("JWTSECRET", &c.JWTSecret)
+	if value, ok := lookup("ADMINS"); ok {
+		c.Admins = strings.Split(value, ",")
+	}
+
+	db := &c.Database
+	setString("DB_DRIVER", &db.Driver)
+	setString("DB_URI", &db.URI)
+	setString("DB_USERNAME", &db.Username)
+	setString("DB_PASSWORD", &db.Password)
+	setString("DB_CONNECTION_STRING", &db.ConnectionString)
+	setString("DB_AUTH_SOURCE", &db.AuthSource)
+	setString("DB_NAME", &db.Name)
+	setString("DB_COLLECTION_STORY_DETAILS", &db.Collections.StoryDetails)
+	setString("DB_COLLECTION_STORY_CONTENT", &db.Collections.StoryContent)
+	setString("DB_COLLECTION_STORY_REVISIONS", &db.Collections.StoryRevisions)
+	setString("DB_COLLECTION_STORY_CHAPTERS", &db.Collections.StoryChapters)
+	setString("DB_COLLECTION_MERGE_REQUESTS", &db.Collections.MergeRequests)
+	if value, ok := lookup("DB_TLS"); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DB_TLS must be true or false, got %q", value))
+		}
+		db.TLS = enabled
+	}
+	setString("DB_TLS_CA_FILE", &db.TLSCAFile)
+	setUint("DB_MAX_POOL_SIZE", &db.MaxPoolSize)
+	setUint("DB_MIN_POOL_SIZE", &db.MinPoolSize)
+	setDuration("DB_MAX_CONN_IDLE_TIME", &db.MaxConnIdleTime)
+	setDuration("DB_TIMEOUT_OPERATION", &db.Timeouts.Operation)
+	setDuration("DB_TIMEOUT_BACKGROUND", &db.Timeouts.Background)
+	setDuration("DB_TIMEOUT_STARTUP", &db.Timeouts.Startup)
+
+	users := &c.Users
+	setString("USERS_DRIVER", &users.Driver)
+	setString("USERS_BASE_URL", &users.BaseURL)
+	setString("USERS_SERVICE_TOKEN", &users.ServiceToken)
+	if value, ok := lookup("USERS_BATCH_SIZE"); ok {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("USERS_BATCH_SIZE must be a number, got %q", value))
+		}
+		users.BatchSize = size
+	}
+	setDuration("USERS_TIMEOUT", &users.Timeout)
+	if value, ok := lookup("USERS_EXISTING"); ok {
+		users.Existing = strings.Split(value, ",")
+	}
+
+	cleanup := &c.Cleanup
+	setDuration("CLEANUP_INTERVAL", &cleanup.Interval)
+	if value, ok := lookup("CLEANUP_DRY_RUN"); ok {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CLEANUP_DRY_RUN must be true or false, got %q", value))
+		}
+		cleanup.DryRun = dryRun
+	}
+	if value, ok := lookup("CLEANUP_MAX_ORPHANED_SHARE"); ok {
+		share, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CLEANUP_MAX_ORPHANED_SHARE must be a number, got %q", value))
+		}
+		cleanup.MaxOrphanedShare = share
+	}
+	setDuration("TRASH_RETENTION", &c.Trash.Retention)
+
+	// docker-compose.yml describes its mongo_bp container with BLUEPRINT_DB_*
+	// variables. They fill in whatever the settings above leave unset.
+	if host, ok := lookup("BLUEPRINT_DB_HOST"); ok && db.URI == "" && db.ConnectionString == "" {
+		port, ok := lookup("BLUEPRINT_DB_PORT")
+		if !ok {
+			port = "27017"
+		}
+		db.URI = "mongodb://" + net.JoinHostPort(host, port)
+	}
+	if db.Username == "" {
+		setString("BLUEPRINT_DB_USERNAME", &db.Username)
+	}
+	if db.Password == "" {
+		setString("BLUEPRINT_DB_ROOT_PASSWORD", &db.Password)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment: %v", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Validate reports every missing or malformed setting at once. Settings are
+// named by their environment variable, followed by their YAML key.
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Port < 1 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT (port) must be between 1 and 65535, got %d", c.Port))
+	}
+	if c.JWTSecret == "" {
+		problems = append(problems, "JWTSECRET (jwt_secret) is required")
+	}
+
+	for _, id := range c.Admins {
+		if !primitive.IsValidObjectID(id) {
+			problems = append(problems, fmt.Sprintf("ADMINS (admins) must list user IDs, got %q", id))
+		}
+	}
+
+	db := &c.Database
+	timeouts := map[string]time.Duration{
+		"DB_TIMEOUT_OPERATION (database.timeouts.operation)":   db.Timeouts.Operation,
+		"DB_TIMEOUT_BACKGROUND (database.timeouts.background)": db.Timeouts.Background,
+		"DB_TIMEOUT_STARTUP (database.timeouts.startup)":       db.Timeouts.Startup,
+	}
+	for _, setting := range slices.Sorted(maps.Keys(timeouts)) {
+		if timeouts[setting] <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive, got %s", setting, timeouts[setting]))
+		}
+	}
+
+	switch db.Driver {
+	case DriverMongo:
+		problems = append(problems, db.validateMongo()...)
+	case DriverMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("DB_DRIVER (database.driver) must be %q or %q, got %q", DriverMongo, DriverMemory, db.Driver))
+	}
+
+	switch c.Users.Driver {
+	case DriverHTTP:
+		problems = append(problems, c.Users.validateHTTP()...)
+	case DriverStatic:
+		for _, id := range c.Users.Existing {
+			if !primitive.IsValidObjectID(id) {
+				problems = append(problems, fmt.Sprintf("USERS_EXISTING (users.existing) must list user IDs, got %q", id))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("USERS_DRIVER (users.driver) must be %q or %q, got %q", DriverHTTP, DriverStatic, c.Users.Driver))
+	}
+
+	if c.Cleanup.Interval <= 0 {
+		problems = append(problems, fmt.Sprintf("CLEANUP_INTERVAL (cleanup.interval) must be positive, got %s", c.Cleanup.Interval))
+	}
+	if c.Cleanup.MaxOrphanedShare < 0 || c.Cleanup.MaxOrphanedShare > 1 {
+		problems = append(problems, fmt.Sprintf("CLEANUP_MAX_ORPHANED_SHARE (cleanup.max_orphaned_share) must be between 0 and 1, got %g", c.Cleanup.MaxOrphanedShare))
+	}
+
+	if c.Trash.Retention <= 0 {
+		problems = append(problems, fmt.Sprintf("TRASH_RETENTION (trash.retention) must be positive, got %s", c.Trash.Retention))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+func (db *Database) validateMongo() []string {
+	var problems []string
+
+	if db.URI != "" {
+		if !strings.HasPrefix(db.URI, "mongodb://") && !strings.HasPrefix(db.URI, "mongodb+srv://") {
+			problems = append(problems, "DB_URI (database.uri) must start with mongodb:// or mongodb+srv://")
+		}
+	} else {
+		if db.Username == "" {
+			problems = append(problems, "DB_USERNAME (database.username) is required by the mongo driver unless DB_URI is set")
+		}
+		if db.Password == "" {
+			problems = append(problems, "DB_PASSWORD (database.password) is required by the mongo driver unless DB_URI is set")
+		}
+		if db.ConnectionString == "" {
+			problems = append(problems, "DB_CONNECTION_STRING (database.connection_string) is required by the mongo driver unless DB_URI is set")
+		}
+	}
+
+	if db.Name == "" {
+		problems = append(problems, "DB_NAME (database.name) must not be empty")
+	}
+	collections := map[string]string{
+		"DB_COLLECTION_STORY_DETAILS (database.collections.story_details)":     db.Collections.StoryDetails,
+		"DB_COLLECTION_STORY_CONTENT (database.collections.story_content)":     db.Collections.StoryContent,
+		"DB_COLLECTION_STORY_REVISIONS (database.collections.story_revisions)": db.Collections.StoryRevisions,
+		"DB_COLLECTION_STORY_CHAPTERS (database.collections.story_chapters)":   db.Collections.StoryChapters,
+		"DB_COLLECTION_MERGE_REQUESTS (database.collections.merge_requests)":   db.Collections.MergeRequests,
+	}
+	seen := make(map[string]bool, len(collections))
+	for _, setting := range slices.Sorted(maps.Keys(collections)) {
+		name := collections[setting]
+		if name == "" {
+			problems = append(problems, setting+" must not be empty")
+		} else if seen[name] {
+			problems = append(problems, fmt.Sprintf("%s reuses the collection %q", setting, name))
+		}
+		seen[name] = true
+	}
+
+	if db.TLSCAFile != "" {
+		if _, err := os.Stat(db.TLSCAFile); err != nil {
+			problems = append(problems, fmt.Sprintf("DB_TLS_CA_FILE (database.tls_ca_file) cannot be read: %v", err))
+		}
+	}
+	if db.MaxPoolSize > 0 && db.MinPoolSize > db.MaxPoolSize {
+		problems = append(problems, fmt.Sprintf("DB_MIN_POOL_SIZE (database.min_pool_size) %d exceeds DB_MAX_POOL_SIZE (database.max_pool_size) %d", db.MinPoolSize, db.MaxPoolSize))
+	}
+
+	return problems
+}
+
+func (users *Users) validateHTTP() []string {
+	var problems []string
+
+	if u, err := url.Parse(users.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("USERS_BASE_URL (users.base_url) must be an http:// or https:// URL, got %q", users.BaseURL))
+	}
+	if users.BatchSize < 1 {
+		problems = append(problems, fmt.Sprintf("USERS_BATCH_SIZE (users.batch_size) must be at least 1, got %d", users.BatchSize))
+	}
+	if users.Timeout <= 0 {
+		problems = append(problems, fmt.Sprintf("USERS_TIMEOUT (users.timeout) must be positive, got %s", users.Timeout))
+	}
+
+	return problems
+}
+
+// Redacted returns a copy of the configuration with its secrets masked.
+func (c Config) Redacted() Config {
+	redact := func(secret string) string {
+		if secret == "" {
+			return ""
+		}
+		return redacted
+	}
+	c.JWTSecret = redact(c.JWTSecret)
+	c.Database.Password = redact(c.Database.Password)
+	c.Database.URI = redactURI(c.Database.URI)
+	c.Users.ServiceToken = redact(c.Users.ServiceToken)
+	return c
+}
+
+// redactURI masks the password a connection URI may carry. It works on the
+// text rather than a parsed URL, which rejects Mongo's comma-separated hosts.
+func redactURI(uri string) string {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return uri
+	}
+	authority, path, hasPath := strings.Cut(rest, "/")
+	at := strings.LastIndex(authority, "@")
+	if at < 0 {
+		return uri
+	}
+	username, _, ok := strings.Cut(authority[:at], ":")
+	if !ok {
+		return uri
+	}
+	redactedURI := scheme + "://" + username + ":" + redacted + authority[at:]
+	if hasPath {
+		redactedURI += "/" + path
+	}
+	return redactedURI
+}
+
+// Print writes the configuration as YAML with its secrets masked.
+func (c Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
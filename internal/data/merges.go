@@ -0,0 +1,57 @@
+package data
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MergeRequestStatus tracks a merge request from proposal to decision.
+type MergeRequestStatus string
+
+const (
+	// MergeRequestOpen requests wait for the upstream owner to decide.
+	MergeRequestOpen MergeRequestStatus = "open"
+	// MergeRequestAccepted requests have had their content applied upstream.
+	MergeRequestAccepted MergeRequestStatus = "accepted"
+	// MergeRequestRejected requests were turned down and changed nothing.
+	MergeRequestRejected MergeRequestStatus = "rejected"
+)
+
+// IsValid reports whether m is one of the known merge request statuses.
+func (m MergeRequestStatus) IsValid() bool {
+	return m == MergeRequestOpen || m == MergeRequestAccepted || m == MergeRequestRejected
+}
+
+// MergeRequest proposes a fork's content to the story it was forked from.
+// The content is captured when the request is opened, so later edits to the
+// fork do not change what was proposed.
+type MergeRequest struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// StoryID is the upstream story the content is proposed to.
+	StoryID     primitive.ObjectID `json:"story_id" bson:"story_id"`
+	ForkID      primitive.ObjectID `json:"fork_id" bson:"fork_id"`
+	AuthorID    primitive.ObjectID `json:"author_id" bson:"author_id"`
+	Title       string             `json:"title" bson:"title"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	Content     string             `json:"content,omitempty" bson:"content"`
+	// BaseRevisionID is the upstream revision that was current when the
+	// request was opened.
+	BaseRevisionID primitive.ObjectID `json:"base_revision_id,omitempty" bson:"base_revision_id,omitempty"`
+	Status         MergeRequestStatus `json:"status" bson:"status"`
+	Comments       []MergeComment     `json:"comments" bson:"comments"`
+	// RevisionID is the upstream revision accepting the request created.
+	RevisionID primitive.ObjectID `json:"revision_id,omitempty" bson:"revision_id,omitempty"`
+	DecidedBy  primitive.ObjectID `json:"decided_by,omitempty" bson:"decided_by,omitempty"`
+	DecidedAt  *time.Time         `json:"decided_at,omitempty" bson:"decided_at,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// MergeComment is one message in a merge request's discussion.
+type MergeComment struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	AuthorID  primitive.ObjectID `json:"author_id" bson:"author_id"`
+	Body      string             `json:"body" bson:"body"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,47 @@
+package data
+
+// StorySort names an order story listings can be returned in.
+type StorySort string
+
+const (
+	SortNewest  StorySort = "newest"
+	SortOldest  StorySort = "oldest"
+	SortUpdated StorySort = "updated"
+	SortTitle   StorySort = "title"
+	SortForks   StorySort = "forks"
+)
+
+// DefaultStorySort is used when a listing does not ask for an order.
+const DefaultStorySort = SortNewest
+
+// IsValid reports whether s is on the allow-list of sortable orders. The
+// empty value is valid and means DefaultStorySort.
+func (s StorySort) IsValid() bool {
+	switch s {
+	case "", SortNewest, SortOldest, SortUpdated, SortTitle, SortForks:
+		return true
+	}
+	return false
+}
+
+// PageRequest asks for one page of a cursor-paginated listing. An empty
+// Cursor starts from the beginning; a zero Limit uses the default size. Sort
+// only applies to story listings, and a cursor is only valid for the sort it
+// was issued under.
+type PageRequest struct {
+	Cursor    string    `json:"cursor"`
+	Limit     int       `json:"limit"`
+	WithTotal bool      `json:"with_total"`
+	Sort      StorySort `json:"sort" validate:"story_sort"`
+}
+
+// Page is one page of a listing. The cursors are opaque and are passed back
+// in PageRequest.Cursor to move forwards or backwards; they are empty when
+// there is nothing further in that direction. Total is only set when it was
+// requested.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+	PrevCursor string
+	Total      *int64
+}
@@ -0,0 +1,152 @@
+package data
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The request types below are what handlers bind request bodies into. They
+// only carry the fields a client may set, so server-owned fields such as IDs,
+// owners, collaborators and timestamps cannot be smuggled in through a body.
+// IDs are hex strings validated with the mongodb tag.
+
+// CreateStoryRequest creates a story owned by the caller.
+type CreateStoryRequest struct {
+	StoryMetadata
+	Visibility Visibility        `json:"visibility" validate:"omitempty,visibility"`
+	Status     PublicationStatus `json:"status" validate:"omitempty,publication_status"`
+}
+
+// Story returns the story the request describes, owned by ownerID.
+func (r *CreateStoryRequest) Story(ownerID primitive.ObjectID) *StoryDetails {
+	return &StoryDetails{
+		Title:       r.Title,
+		Genre:       r.Genre,
+		Description: r.Description,
+		OwnerID:     ownerID,
+		Visibility:  r.Visibility,
+		Status:      r.Status,
+	}
+}
+
+type EditStoryRequest struct {
+	StoryID string `json:"story_id" validate:"required,mongodb"`
+	Content string `json:"content" validate:"required,min=20"`
+}
+
+type SetVisibilityRequest struct {
+	StoryID    string     `json:"story_id" validate:"required,mongodb"`
+	Visibility Visibility `json:"visibility" validate:"required,visibility"`
+}
+
+type StoriesByFiltersRequest struct {
+	PageRequest
+	Genres []string `json:"genres"`
+}
+
+type StoriesByUserRequest struct {
+	PageRequest
+	UserID string `json:"user_id" validate:"required,mongodb"`
+}
+
+type SearchRequest struct {
+	PageRequest
+	Query  string   `json:"query" validate:"required,max=200"`
+	Genres []string `json:"genres"`
+	// Sort shadows PageRequest.Sort. Results are always ranked by
+	// relevance, so asking for another order is rejected, not ignored.
+	Sort StorySort `json:"sort" validate:"isdefault"`
+}
+
+// CreateChapterRequest appends a chapter to a story.
+type CreateChapterRequest struct {
+	StoryID string `json:"story_id" validate:"required,mongodb"`
+	Title   string `json:"title" validate:"required,max=200"`
+	Content string `json:"content"`
+}
+
+// EditChapterRequest changes a chapter's title and/or content; fields left
+// out of the body are left untouched.
+type EditChapterRequest struct {
+	StoryID   string  `json:"story_id" validate:"required,mongodb"`
+	ChapterID string  `json:"chapter_id" validate:"required,mongodb"`
+	Title     *string `json:"title" validate:"omitempty,min=1,max=200"`
+	Content   *string `json:"content"`
+}
+
+type ReorderChaptersRequest struct {
+	StoryID    string   `json:"story_id" validate:"required,mongodb"`
+	ChapterIDs []string `json:"chapter_ids" validate:"required,dive,mongodb"`
+}
+
+// InviteCollaboratorRequest invites a user to a story. An empty role means
+// DefaultCollaboratorRole.
+type InviteCollaboratorRequest struct {
+	StoryID string `json:"story_id" validate:"required,mongodb"`
+	UserID  string `json:"user_id" validate:"required,mongodb"`
+	Role    Role   `json:"role" validate:"omitempty,collaborator_role"`
+}
+
+type SetCollaboratorRoleRequest struct {
+	StoryID string `json:"story_id" validate:"required,mongodb"`
+	UserID  string `json:"user_id" validate:"required,mongodb"`
+	Role    Role   `json:"role" validate:"required,collaborator_role"`
+}
+
+type TransferOwnershipRequest struct {
+	StoryID string `json:"story_id" validate:"required,mongodb"`
+	UserID  string `json:"user_id" validate:"required,mongodb"`
+}
+
+// PublishStoryRequest publishes a story now, or schedules it when PublishAt
+// is in the future.
+type PublishStoryRequest struct {
+	StoryID   string     `json:"story_id" validate:"required,mongodb"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+type UnpublishStoryRequest struct {
+	StoryID string `json:"story_id" validate:"required,mongodb"`
+	Archive bool   `json:"archive"`
+}
+
+type StoryRevisionsRequest struct {
+	PageRequest
+	StoryID string `json:"story_id" validate:"required,mongodb"`
+}
+
+type StoryForksRequest struct {
+	PageRequest
+	StoryID string `json:"story_id" validate:"required,mongodb"`
+}
+
+type RestoreRevisionRequest struct {
+	StoryID    string `json:"story_id" validate:"required,mongodb"`
+	RevisionID string `json:"revision_id" validate:"required,mongodb"`
+}
+
+// CleanupRequest starts an orphan cleanup run. DryRun overrides the
+// configured default when set.
+type CleanupRequest struct {
+	DryRun *bool `json:"dry_run"`
+}
+
+type CreateMergeRequestRequest struct {
+	ForkID      string `json:"fork_id" validate:"required,mongodb"`
+	Title       string `json:"title" validate:"required,min=3,max=100"`
+	Description string `json:"description" validate:"max=2000"`
+}
+
+// MergeRequestsRequest lists a story's merge requests, only those with
+// Status when it is set.
+type MergeRequestsRequest struct {
+	PageRequest
+	StoryID string             `json:"story_id" validate:"required,mongodb"`
+	Status  MergeRequestStatus `json:"status" validate:"omitempty,merge_request_status"`
+}
+
+type MergeCommentRequest struct {
+	MergeRequestID string `json:"merge_request_id" validate:"required,mongodb"`
+	Body           string `json:"body" validate:"required,max=2000"`
+}
@@ -0,0 +1,81 @@
+package data
+
+import (
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Role is a user's level of access to a single story.
+type Role string
+
+const (
+	RoleNone      Role = ""
+	RoleViewer    Role = "viewer"
+	RoleCommenter Role = "commenter"
+	RoleEditor    Role = "editor"
+	RoleOwner     Role = "owner"
+)
+
+// DefaultCollaboratorRole is given to collaborators with no explicit role,
+// which covers every collaborator added before roles existed.
+const DefaultCollaboratorRole = RoleEditor
+
+// IsCollaboratorRole reports whether r can be assigned to a collaborator.
+// Ownership is only ever transferred, never assigned.
+func IsCollaboratorRole(r Role) bool {
+	return r == RoleViewer || r == RoleCommenter || r == RoleEditor
+}
+
+// StoryAccess is who has been invited to a story and the role each
+// collaborator or invitee holds. It is only shown to those who can manage
+// the story's collaborators.
+type StoryAccess struct {
+	Invitations []primitive.ObjectID `json:"invitations"`
+	Roles       map[string]Role      `json:"roles"`
+}
+
+// Access returns the story's pending invitations and roles.
+func (s *StoryDetails) Access() StoryAccess {
+	access := StoryAccess{Invitations: []primitive.ObjectID{}, Roles: map[string]Role{}}
+	access.Invitations = append(access.Invitations, s.Invitations...)
+	for id, role := range s.Roles {
+		access.Roles[id] = role
+	}
+	return access
+}
+
+// EffectiveVisibility returns the story's visibility, treating stories saved
+// without one as public.
+func (s *StoryDetails) EffectiveVisibility() Visibility {
+	if s.Visibility == "" {
+		return VisibilityPublic
+	}
+	return s.Visibility
+}
+
+// EffectiveStatus returns the story's publication status, treating stories
+// saved without one as published.
+func (s *StoryDetails) EffectiveStatus() PublicationStatus {
+	if s.Status == "" {
+		return StatusPublished
+	}
+	return s.Status
+}
+
+// RoleOf returns the role userID holds on the story.
+func (s *StoryDetails) RoleOf(userID primitive.ObjectID) Role {
+	if userID.IsZero() {
+		return RoleNone
+	}
+	if userID == s.OwnerID {
+		return RoleOwner
+	}
+	if slices.Contains(s.Collaborators, userID) {
+		if role, ok := s.Roles[userID.Hex()]; ok && IsCollaboratorRole(role) {
+			return role
+		}
+		return DefaultCollaboratorRole
+	}
+	return RoleNone
+}
@@ -6,22 +6,123 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Visibility controls who can read a story and whether it is listed.
+type Visibility string
+
+const (
+	// VisibilityPrivate stories are readable by their owner and collaborators only.
+	VisibilityPrivate Visibility = "private"
+	// VisibilityUnlisted stories are readable by anyone with the link but are
+	// left out of listings.
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityPublic stories are readable and listed for everyone. Stories
+	// created before visibility existed have no value and are treated as public.
+	VisibilityPublic Visibility = "public"
+)
+
+// IsValid reports whether v is one of the known visibility levels.
+func (v Visibility) IsValid() bool {
+	return v == VisibilityPrivate || v == VisibilityUnlisted || v == VisibilityPublic
+}
+
+// PublicationStatus tracks where a story is in the draft/publish workflow.
+type PublicationStatus string
+
+const (
+	// StatusDraft stories are only visible to their owner and collaborators.
+	StatusDraft PublicationStatus = "draft"
+	// StatusPublished stories follow their visibility. Stories created before
+	// the workflow existed have no status and are treated as published.
+	StatusPublished PublicationStatus = "published"
+	// StatusArchived stories stay readable but are left out of listings.
+	StatusArchived PublicationStatus = "archived"
+)
+
+// IsValid reports whether p is one of the known publication statuses.
+func (p PublicationStatus) IsValid() bool {
+	return p == StatusDraft || p == StatusPublished || p == StatusArchived
+}
+
 type StoryDetails struct {
 	ID            primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
 	Title         string               `json:"title" bson:"title" validate:"required,min=3,max=100"`
 	Genre         string               `json:"genre" bson:"genre" validate:"required,min=3,max=100"`
 	Description   string               `json:"description" bson:"description" validate:"required,min=10,max=500"`
 	OwnerID       primitive.ObjectID   `json:"owner_id" bson:"owner_id" validate:"required"`
+	Visibility    Visibility           `json:"visibility,omitempty" bson:"visibility,omitempty"`
+	Status        PublicationStatus    `json:"status,omitempty" bson:"status,omitempty"`
+	PublishedAt   *time.Time           `json:"published_at,omitempty" bson:"published_at,omitempty"`
+	ScheduledAt   *time.Time           `json:"scheduled_at,omitempty" bson:"scheduled_at,omitempty"`
 	Collaborators []primitive.ObjectID `json:"collaborators,omitempty" bson:"collaborators,omitempty"`
+	Invitations   []primitive.ObjectID `json:"-" bson:"invitations,omitempty"`
+	Roles         map[string]Role      `json:"-" bson:"roles,omitempty"`
 	CreatedAt     time.Time            `json:"created_at" bson:"created_at"`
 	UpdatedAt     time.Time            `json:"updated_at" bson:"updated_at"`
 	ForkedFrom    primitive.ObjectID   `json:"forked_from,omitempty" bson:"forked_from,omitempty"`
+	ForkCount     int                  `json:"fork_count" bson:"fork_count"`
+	// ForkRevision is the revision of ForkedFrom a fork copied, unset when
+	// that story had no content to copy.
+	ForkRevision primitive.ObjectID `json:"fork_revision,omitempty" bson:"fork_revision,omitempty"`
+	// DeletedAt is set while the story is in its owner's trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+// StoryMetadata is the part of a story's details that describes it and can
+// be edited after it is created.
+type StoryMetadata struct {
+	Title       string `json:"title" validate:"required,min=3,max=100"`
+	Genre       string `json:"genre" validate:"required,min=3,max=100"`
+	Description string `json:"description" validate:"required,min=10,max=500"`
+}
+
+// Trashed reports whether the story has been deleted but not yet purged.
+func (s *StoryDetails) Trashed() bool {
+	return s.DeletedAt != nil
+}
+
+// Metadata returns the story's current metadata.
+func (s *StoryDetails) Metadata() StoryMetadata {
+	return StoryMetadata{Title: s.Title, Genre: s.Genre, Description: s.Description}
+}
+
+// ForkNode is a story in a fork tree along with the forks made from it.
+type ForkNode struct {
+	Story StoryDetails `json:"story"`
+	Forks []ForkNode   `json:"forks"`
+	// Truncated is set on stories at the depth limit with listed forks of
+	// their own.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 type StoryContent struct {
-	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	StoryID primitive.ObjectID `json:"story_id" bson:"story_id" validate:"required"`
-	Content string             `json:"content" bson:"content" validate:"required,min=20"`
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	StoryID    primitive.ObjectID `json:"story_id" bson:"story_id" validate:"required"`
+	Content    string             `json:"content" bson:"content" validate:"required,min=20"`
+	RevisionID primitive.ObjectID `json:"revision_id,omitempty" bson:"revision_id,omitempty"`
+}
+
+// StoryRevision is an immutable snapshot of a story's content taken on every
+// edit. The storycontent document always mirrors the latest revision.
+type StoryRevision struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	StoryID      primitive.ObjectID `json:"story_id" bson:"story_id"`
+	AuthorID     primitive.ObjectID `json:"author_id" bson:"author_id"`
+	Content      string             `json:"content,omitempty" bson:"content"`
+	Size         int                `json:"size" bson:"size"`
+	RestoredFrom primitive.ObjectID `json:"restored_from,omitempty" bson:"restored_from,omitempty"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Chapter is an ordered section of a story. When a story has chapters its
+// StoryContent is kept as their concatenation so older clients still work.
+type Chapter struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	StoryID   primitive.ObjectID `json:"story_id" bson:"story_id" validate:"required"`
+	Title     string             `json:"title" bson:"title" validate:"required,min=1,max=200"`
+	Order     int                `json:"order" bson:"order"`
+	Content   string             `json:"content,omitempty" bson:"content"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
 type ForkRequest struct {
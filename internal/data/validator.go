@@ -2,6 +2,8 @@ package data
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -10,8 +12,34 @@ var validate *validator.Validate
 
 func init() {
 	validate = validator.New()
+
+	// Report fields by the names clients send them under.
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	for tag, valid := range map[string]func(string) bool{
+		"visibility":           func(s string) bool { return Visibility(s).IsValid() },
+		"publication_status":   func(s string) bool { return PublicationStatus(s).IsValid() },
+		"collaborator_role":    func(s string) bool { return IsCollaboratorRole(Role(s)) },
+		"story_sort":           func(s string) bool { return StorySort(s).IsValid() },
+		"merge_request_status": func(s string) bool { return MergeRequestStatus(s).IsValid() },
+	} {
+		err := validate.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+			return valid(fl.Field().String())
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
 }
 
+// ValidateStruct checks s against its validate tags. When it fails, the map
+// holds a readable message for every invalid field, keyed by its JSON name.
 func ValidateStruct(s any) (map[string]string, error) {
 	err := validate.Struct(s)
 	if err != nil {
@@ -22,9 +50,43 @@ func ValidateStruct(s any) (map[string]string, error) {
 		validationErrors := err.(validator.ValidationErrors)
 		errorsMap := make(map[string]string)
 		for _, fieldErr := range validationErrors {
-			errorsMap[fieldErr.Field()] = fmt.Sprintf("failed on '%s' tag", fieldErr.Tag())
+			errorsMap[fieldErr.Field()] = describeFieldError(fieldErr)
 		}
 		return errorsMap, fmt.Errorf("validation errors")
 	}
 	return nil, nil
 }
+
+func describeFieldError(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "min", "max":
+		bound := "at least"
+		if fieldErr.Tag() == "max" {
+			bound = "at most"
+		}
+		switch fieldErr.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("must be %s %s characters long", bound, fieldErr.Param())
+		case reflect.Slice, reflect.Map:
+			return fmt.Sprintf("must have %s %s items", bound, fieldErr.Param())
+		}
+		return fmt.Sprintf("must be %s %s", bound, fieldErr.Param())
+	case "mongodb":
+		return "must be a valid ID"
+	case "isdefault":
+		return "is not supported here"
+	case "visibility":
+		return "must be one of private, unlisted or public"
+	case "publication_status":
+		return "must be one of draft, published or archived"
+	case "collaborator_role":
+		return "must be one of viewer, commenter or editor"
+	case "story_sort":
+		return "must be one of newest, oldest, updated, title or forks"
+	case "merge_request_status":
+		return "must be one of open, accepted or rejected"
+	}
+	return fmt.Sprintf("failed on '%s' tag", fieldErr.Tag())
+}
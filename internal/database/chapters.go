@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// CreateChapter appends a chapter to the end of a story. The first chapter
+// added to a story that already has content keeps that content as a leading
+// chapter so nothing is lost when a story is split up.
+func (s *service) CreateChapter(ctx context.Context, storyID, authorID primitive.ObjectID, title, content string) (primitive.ObjectID, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var chapterID primitive.ObjectID
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		chapterID, err = s.createChapter(ctx, storyID, authorID, title, content)
+		return err
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return chapterID, nil
+}
+
+// createChapter inserts the chapter and rebuilds the story's content.
+func (s *service) createChapter(ctx context.Context, storyID, authorID primitive.ObjectID, title, content string) (primitive.ObjectID, error) {
+	chapters := s.storyChapters()
+
+	count, err := chapters.CountDocuments(ctx, primitive.M{"story_id": storyID})
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error counting chapters: %v", err)
+	}
+
+	order := 0
+	if count == 0 {
+		var existing data.StoryContent
+		err := s.storyContent().FindOne(ctx, primitive.M{"story_id": storyID}).Decode(&existing)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return primitive.NilObjectID, fmt.Errorf("error finding story content: %v", err)
+		}
+		if err == nil && existing.Content != "" {
+			if _, err := chapters.InsertOne(ctx, newChapter(storyID, "Chapter 1", 0, existing.Content)); err != nil {
+				return primitive.NilObjectID, fmt.Errorf("error inserting chapter: %v", err)
+			}
+			order = 1
+		}
+	} else {
+		var last data.Chapter
+		findOptions := options.FindOne().SetSort(primitive.D{{Key: "order", Value: -1}})
+		if err := chapters.FindOne(ctx, primitive.M{"story_id": storyID}, findOptions).Decode(&last); err != nil {
+			return primitive.NilObjectID, fmt.Errorf("error finding last chapter: %v", err)
+		}
+		order = last.Order + 1
+	}
+
+	res, err := chapters.InsertOne(ctx, newChapter(storyID, title, order, content))
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error inserting chapter: %v", err)
+	}
+
+	if err := s.syncChapterContent(ctx, storyID, authorID); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return res.InsertedID.(primitive.ObjectID), nil
+}
+
+func newChapter(storyID primitive.ObjectID, title string, order int, content string) data.Chapter {
+	now := time.Now()
+	return data.Chapter{
+		StoryID:   storyID,
+		Title:     title,
+		Order:     order,
+		Content:   content,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// GetChapters lists a story's chapters in reading order without their content.
+func (s *service) GetChapters(ctx context.Context, storyID primitive.ObjectID) ([]data.Chapter, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	findOptions := options.Find().
+		SetSort(primitive.D{{Key: "order", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(primitive.M{"content": 0})
+
+	cursor, err := s.storyChapters().Find(ctx, primitive.M{"story_id": storyID}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching chapters: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var chapters []data.Chapter
+	if err := cursor.All(ctx, &chapters); err != nil {
+		return nil, fmt.Errorf("error decoding chapters: %v", err)
+	}
+
+	return chapters, nil
+}
+
+func (s *service) GetChapter(ctx context.Context, storyID, chapterID primitive.ObjectID) (*data.Chapter, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var chapter data.Chapter
+	filter := primitive.M{"_id": chapterID, "story_id": storyID}
+	err := s.storyChapters().FindOne(ctx, filter).Decode(&chapter)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, notFound("chapter not found")
+		}
+		return nil, fmt.Errorf("error fetching chapter: %v", err)
+	}
+
+	return &chapter, nil
+}
+
+func (s *service) CountChapters(ctx context.Context, storyID primitive.ObjectID) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	count, err := s.storyChapters().CountDocuments(ctx, primitive.M{"story_id": storyID})
+	if err != nil {
+		return 0, fmt.Errorf("error counting chapters: %v", err)
+	}
+
+	return count, nil
+}
+
+// EditChapter updates the title and/or content of a chapter; nil fields are
+// left untouched. It reports false when the chapter does not exist.
+func (s *service) EditChapter(ctx context.Context, storyID, chapterID, authorID primitive.ObjectID, title, content *string) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	set := primitive.M{"updated_at": time.Now()}
+	if title != nil {
+		set["title"] = *title
+	}
+	if content != nil {
+		set["content"] = *content
+	}
+
+	var updated bool
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		filter := primitive.M{"_id": chapterID, "story_id": storyID}
+		res, err := s.storyChapters().UpdateOne(ctx, filter, primitive.M{"$set": set})
+		if err != nil {
+			return fmt.Errorf("error updating chapter: %v", err)
+		}
+		updated = res.MatchedCount > 0
+		if !updated {
+			return nil
+		}
+		return s.syncChapterContent(ctx, storyID, authorID)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return updated, nil
+}
+
+func (s *service) DeleteChapter(ctx context.Context, storyID, chapterID, authorID primitive.ObjectID) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var deleted bool
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		filter := primitive.M{"_id": chapterID, "story_id": storyID}
+		res, err := s.storyChapters().DeleteOne(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("error deleting chapter: %v", err)
+		}
+		deleted = res.DeletedCount > 0
+		if !deleted {
+			return nil
+		}
+		return s.syncChapterContent(ctx, storyID, authorID)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// ReorderChapters sets the reading order to that of chapterIDs, which must
+// name every chapter of the story exactly once. It reports false otherwise.
+func (s *service) ReorderChapters(ctx context.Context, storyID, authorID primitive.ObjectID, chapterIDs []primitive.ObjectID) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	chapters := s.storyChapters()
+
+	existing, err := chapters.Distinct(ctx, "_id", primitive.M{"story_id": storyID})
+	if err != nil {
+		return false, fmt.Errorf("error fetching chapters: %v", err)
+	}
+	if len(existing) != len(chapterIDs) {
+		return false, nil
+	}
+	known := make(map[primitive.ObjectID]bool, len(existing))
+	for _, id := range existing {
+		if objID, ok := id.(primitive.ObjectID); ok {
+			known[objID] = true
+		}
+	}
+	for _, id := range chapterIDs {
+		if !known[id] {
+			return false, nil
+		}
+		delete(known, id)
+	}
+
+	models := make([]mongo.WriteModel, 0, len(chapterIDs))
+	for i, id := range chapterIDs {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(primitive.M{"_id": id, "story_id": storyID}).
+			SetUpdate(primitive.M{"$set": primitive.M{"order": i}}))
+	}
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		if _, err := chapters.BulkWrite(ctx, models); err != nil {
+			return fmt.Errorf("error reordering chapters: %v", err)
+		}
+		return s.syncChapterContent(ctx, storyID, authorID)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// syncChapterContent rebuilds the story's content from its chapters and
+// records it as a new revision authored by authorID. Callers run it in the
+// same transaction as the chapter write it follows, so the chapters and the
+// content never disagree.
+func (s *service) syncChapterContent(ctx context.Context, storyID, authorID primitive.ObjectID) error {
+	findOptions := options.Find().SetSort(primitive.D{{Key: "order", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := s.storyChapters().Find(ctx, primitive.M{"story_id": storyID}, findOptions)
+	if err != nil {
+		return fmt.Errorf("error fetching chapters: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var chapters []data.Chapter
+	if err := cursor.All(ctx, &chapters); err != nil {
+		return fmt.Errorf("error decoding chapters: %v", err)
+	}
+
+	content := joinChapters(chapters)
+
+	if err := s.baselineRevision(ctx, storyID); err != nil {
+		return err
+	}
+	revisionID, err := s.insertRevision(ctx, storyID, authorID, content, primitive.NilObjectID)
+	if err != nil {
+		return err
+	}
+	if err := s.setContentHead(ctx, storyID, revisionID, content); err != nil {
+		return err
+	}
+
+	_, err = s.storyDetails().UpdateOne(ctx, primitive.M{"_id": storyID}, primitive.M{"$set": primitive.M{"updated_at": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("error updating story details: %v", err)
+	}
+
+	return nil
+}
+
+// joinChapters renders chapters, already in reading order, as a single text
+// with each chapter's title heading its content.
+func joinChapters(chapters []data.Chapter) string {
+	parts := make([]string, 0, len(chapters))
+	for _, chapter := range chapters {
+		parts = append(parts, chapter.Title+"\n\n"+chapter.Content)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// copyChapters duplicates every chapter of one story onto another, as done
+// when a story is forked.
+func (s *service) copyChapters(ctx context.Context, fromStoryID, toStoryID primitive.ObjectID) error {
+	cursor, err := s.storyChapters().Find(ctx, primitive.M{"story_id": fromStoryID})
+	if err != nil {
+		return fmt.Errorf("error fetching chapters: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var chapters []data.Chapter
+	if err := cursor.All(ctx, &chapters); err != nil {
+		return fmt.Errorf("error decoding chapters: %v", err)
+	}
+	if len(chapters) == 0 {
+		return nil
+	}
+
+	copies := make([]any, 0, len(chapters))
+	for _, chapter := range chapters {
+		copies = append(copies, newChapter(toStoryID, chapter.Title, chapter.Order, chapter.Content))
+	}
+	if _, err := s.storyChapters().InsertMany(ctx, copies); err != nil {
+		return fmt.Errorf("error copying chapters: %v", err)
+	}
+
+	return nil
+}
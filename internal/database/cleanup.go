@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/users"
+)
+
+// CleanupOptions controls one run of CleanupOrphanedStories.
+type CleanupOptions struct {
+	// DryRun reports what the run would remove without removing it.
+	DryRun bool
+	// MaxOrphanedShare is the largest share of story owners, from 0 to 1,
+	// that may look orphaned before the run is aborted. A directory that
+	// suddenly reports most users as deleted is far more likely to be
+	// misconfigured than right.
+	MaxOrphanedShare float64
+}
+
+// CleanupReport describes one run of orphan cleanup: the owners it found to
+// be deleted, and what it removed because of them, or would have removed in
+// a dry run.
+type CleanupReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DryRun     bool      `json:"dry_run"`
+	// OwnersChecked is the number of distinct story owners looked up.
+	OwnersChecked  int                  `json:"owners_checked"`
+	OrphanedOwners []primitive.ObjectID `json:"orphaned_owners"`
+	// Stories are the stories owned by orphaned owners.
+	Stories []primitive.ObjectID `json:"stories"`
+	// CollaboratorRemovals are the orphaned users taken off other stories.
+	CollaboratorRemovals []CollaboratorRemoval `json:"collaborator_removals"`
+	// Aborted is set when too many owners looked orphaned for the run to go
+	// ahead. Nothing is removed from an aborted run.
+	Aborted     bool   `json:"aborted"`
+	AbortReason string `json:"abort_reason,omitempty"`
+	// Error is set when the run failed partway.
+	Error string `json:"error,omitempty"`
+}
+
+// CollaboratorRemoval is an orphaned user taken off a story they were a
+// collaborator on, or only invited to.
+type CollaboratorRemoval struct {
+	StoryID primitive.ObjectID `json:"story_id"`
+	UserID  primitive.ObjectID `json:"user_id"`
+	Invited bool               `json:"invited"`
+}
+
+// collaboratorRemovals lists the orphaned users on each of stories.
+func collaboratorRemovals(stories []data.StoryDetails, orphaned []primitive.ObjectID) []CollaboratorRemoval {
+	var removals []CollaboratorRemoval
+	for _, story := range stories {
+		for _, userID := range orphaned {
+			if slices.Contains(story.Collaborators, userID) {
+				removals = append(removals, CollaboratorRemoval{StoryID: story.ID, UserID: userID})
+			} else if slices.Contains(story.Invitations, userID) {
+				removals = append(removals, CollaboratorRemoval{StoryID: story.ID, UserID: userID, Invited: true})
+			}
+		}
+	}
+	slices.SortFunc(removals, func(a, b CollaboratorRemoval) int {
+		if c := compareIDs(a.StoryID, b.StoryID); c != 0 {
+			return c
+		}
+		return compareIDs(a.UserID, b.UserID)
+	})
+	return removals
+}
+
+// abort marks report as aborted when more of the owners it checked look
+// orphaned than opts allow.
+func (opts CleanupOptions) abort(report *CleanupReport) bool {
+	if len(report.OrphanedOwners) == 0 {
+		return false
+	}
+	share := float64(len(report.OrphanedOwners)) / float64(report.OwnersChecked)
+	if share <= opts.MaxOrphanedShare {
+		return false
+	}
+	report.Aborted = true
+	report.AbortReason = fmt.Sprintf("%d of %d owners look orphaned, more than the %g%% allowed",
+		len(report.OrphanedOwners), report.OwnersChecked, opts.MaxOrphanedShare*100)
+	return true
+}
+
+// cleanupRuns keeps cleanup runs from overlapping and remembers the report of
+// the last one.
+type cleanupRuns struct {
+	running sync.Mutex
+
+	mu   sync.Mutex
+	last *CleanupReport
+}
+
+// run fills in a report with fn and records it, even when fn fails. It
+// refuses to start while another run is in progress.
+func (r *cleanupRuns) run(opts CleanupOptions, fn func(report *CleanupReport) error) (*CleanupReport, error) {
+	if !r.running.TryLock() {
+		return nil, conflict("orphan cleanup is already running")
+	}
+	defer r.running.Unlock()
+
+	report := &CleanupReport{
+		StartedAt:            time.Now(),
+		DryRun:               opts.DryRun,
+		OrphanedOwners:       []primitive.ObjectID{},
+		Stories:              []primitive.ObjectID{},
+		CollaboratorRemovals: []CollaboratorRemoval{},
+	}
+	err := fn(report)
+	report.FinishedAt = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	r.last = report
+	r.mu.Unlock()
+
+	return report, err
+}
+
+func (r *cleanupRuns) lastReport() *CleanupReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// CleanupOrphanedStories removes the stories of owners the user directory
+// reports as deleted, along with their content, revisions and chapters, and
+// takes those users off the stories they collaborate on or are invited to.
+func (s *service) CleanupOrphanedStories(ctx context.Context, opts CleanupOptions) (*CleanupReport, error) {
+	return s.cleanups.run(opts, func(report *CleanupReport) error {
+		ctx, cancel := context.WithTimeout(ctx, s.timeouts.Background)
+		defer cancel()
+		return s.cleanupOrphanedStories(ctx, opts, report)
+	})
+}
+
+func (s *service) LastCleanupReport() *CleanupReport {
+	return s.cleanups.lastReport()
+}
+
+func (s *service) cleanupOrphanedStories(ctx context.Context, opts CleanupOptions, report *CleanupReport) error {
+	distinctResult, err := s.storyDetails().Distinct(ctx, "owner_id", primitive.M{})
+	if err != nil {
+		return fmt.Errorf("error fetching unique owner IDs: %v", err)
+	}
+
+	var ownerIDs []primitive.ObjectID
+	for _, id := range distinctResult {
+		if objID, ok := id.(primitive.ObjectID); ok {
+			ownerIDs = append(ownerIDs, objID)
+		}
+	}
+	report.OwnersChecked = len(ownerIDs)
+
+	orphanedOwnerIDs, err := orphanedOwners(ctx, s.directory, ownerIDs)
+	if err != nil {
+		return err
+	}
+	if len(orphanedOwnerIDs) == 0 {
+		return nil
+	}
+	report.OrphanedOwners = orphanedOwnerIDs
+	if opts.abort(report) {
+		return nil
+	}
+
+	cursor, err := s.storyDetails().Find(ctx,
+		primitive.M{"owner_id": primitive.M{"$in": orphanedOwnerIDs}},
+		options.Find().SetProjection(primitive.M{"_id": 1, "forked_from": 1, "deleted_at": 1}),
+	)
+	if err != nil {
+		return fmt.Errorf("error finding orphaned stories: %v", err)
+	}
+	var orphanedStories []data.StoryDetails
+	if err := cursor.All(ctx, &orphanedStories); err != nil {
+		return fmt.Errorf("error decoding orphaned stories: %v", err)
+	}
+	for _, story := range orphanedStories {
+		report.Stories = append(report.Stories, story.ID)
+	}
+	slices.SortFunc(report.Stories, compareIDs)
+
+	cursor, err = s.storyDetails().Find(ctx,
+		primitive.M{
+			"owner_id": primitive.M{"$nin": orphanedOwnerIDs},
+			"$or": primitive.A{
+				primitive.M{"collaborators": primitive.M{"$in": orphanedOwnerIDs}},
+				primitive.M{"invitations": primitive.M{"$in": orphanedOwnerIDs}},
+			},
+		},
+		options.Find().SetProjection(primitive.M{"_id": 1, "collaborators": 1, "invitations": 1}),
+	)
+	if err != nil {
+		return fmt.Errorf("error finding stories with orphaned collaborators: %v", err)
+	}
+	var collaborated []data.StoryDetails
+	if err := cursor.All(ctx, &collaborated); err != nil {
+		return fmt.Errorf("error decoding stories with orphaned collaborators: %v", err)
+	}
+	if removals := collaboratorRemovals(collaborated, orphanedOwnerIDs); removals != nil {
+		report.CollaboratorRemovals = removals
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	return s.withTransaction(ctx, func(ctx context.Context) error {
+		if len(orphanedStories) > 0 {
+			if _, err := s.storyDetails().DeleteMany(ctx, primitive.M{"_id": primitive.M{"$in": report.Stories}}); err != nil {
+				return fmt.Errorf("error deleting orphaned stories: %v", err)
+			}
+			if err := s.deleteStoryData(ctx, orphanedStories); err != nil {
+				return err
+			}
+		}
+
+		orphanedRoles := primitive.M{}
+		for _, id := range orphanedOwnerIDs {
+			orphanedRoles[roleField(id)] = ""
+		}
+		for _, field := range []string{"collaborators", "invitations"} {
+			_, err := s.storyDetails().UpdateMany(ctx,
+				primitive.M{field: primitive.M{"$in": orphanedOwnerIDs}},
+				primitive.M{
+					"$pull":  primitive.M{field: primitive.M{"$in": orphanedOwnerIDs}},
+					"$unset": orphanedRoles,
+				},
+			)
+			if err != nil {
+				return fmt.Errorf("error removing orphaned users from %s: %v", field, err)
+			}
+		}
+		return nil
+	})
+}
+
+// orphanedOwners asks directory which of ownerIDs no longer exist. Owners
+// it has no answer for are not treated as orphaned.
+func orphanedOwners(ctx context.Context, directory users.Directory, ownerIDs []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	if directory == nil {
+		return nil, errors.New("orphan cleanup needs a user directory")
+	}
+	if len(ownerIDs) == 0 {
+		return nil, nil
+	}
+
+	found, err := directory.Lookup(ctx, ownerIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up story owners: %v", err)
+	}
+
+	var orphanedOwnerIDs []primitive.ObjectID
+	for _, ownerID := range ownerIDs {
+		if exists, ok := found[ownerID]; ok && !exists {
+			orphanedOwnerIDs = append(orphanedOwnerIDs, ownerID)
+		}
+	}
+	slices.SortFunc(orphanedOwnerIDs, compareIDs)
+	return orphanedOwnerIDs, nil
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// InviteCollaborator adds userID to the story's pending invitations with the
+// role they will hold once they accept. It reports false when the user is the
+// owner, already a collaborator or already invited.
+func (s *service) InviteCollaborator(ctx context.Context, storyID, userID primitive.ObjectID, role data.Role) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter := primitive.M{
+		"_id":           storyID,
+		"owner_id":      primitive.M{"$ne": userID},
+		"collaborators": primitive.M{"$ne": userID},
+		"invitations":   primitive.M{"$ne": userID},
+	}
+	update := primitive.M{
+		"$addToSet": primitive.M{"invitations": userID},
+		"$set":      primitive.M{roleField(userID): role},
+	}
+
+	res, err := s.storyDetails().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error inviting collaborator: %v", err)
+	}
+
+	return res.ModifiedCount > 0, nil
+}
+
+// RespondToInvitation removes userID's pending invitation and, when accept
+// is set, adds them to the collaborators. It reports false when no pending
+// invitation exists, which includes invitations to stories in the trash.
+func (s *service) RespondToInvitation(ctx context.Context, storyID, userID primitive.ObjectID, accept bool) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter := notTrashed(primitive.M{"_id": storyID, "invitations": userID})
+	update := primitive.M{"$pull": primitive.M{"invitations": userID}}
+	if accept {
+		update["$addToSet"] = primitive.M{"collaborators": userID}
+		update["$set"] = primitive.M{"updated_at": time.Now()}
+	} else {
+		update["$unset"] = primitive.M{roleField(userID): ""}
+	}
+
+	res, err := s.storyDetails().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error responding to invitation: %v", err)
+	}
+
+	return res.ModifiedCount > 0, nil
+}
+
+// RemoveCollaborator drops userID from the story's collaborators and
+// cancels any pending invitation they may have.
+func (s *service) RemoveCollaborator(ctx context.Context, storyID, userID primitive.ObjectID) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter := primitive.M{
+		"_id": storyID,
+		"$or": primitive.A{
+			primitive.M{"collaborators": userID},
+			primitive.M{"invitations": userID},
+		},
+	}
+	update := primitive.M{
+		"$pull":  primitive.M{"collaborators": userID, "invitations": userID},
+		"$unset": primitive.M{roleField(userID): ""},
+		"$set":   primitive.M{"updated_at": time.Now()},
+	}
+
+	res, err := s.storyDetails().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error removing collaborator: %v", err)
+	}
+
+	return res.ModifiedCount > 0, nil
+}
+
+// SetCollaboratorRole changes the role of an existing collaborator. It
+// reports false when userID is not a collaborator on the story.
+func (s *service) SetCollaboratorRole(ctx context.Context, storyID, userID primitive.ObjectID, role data.Role) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter := primitive.M{"_id": storyID, "collaborators": userID}
+	update := primitive.M{"$set": primitive.M{roleField(userID): role, "updated_at": time.Now()}}
+
+	res, err := s.storyDetails().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error setting collaborator role: %v", err)
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+// TransferOwnership makes an existing collaborator the owner of the story.
+// The previous owner stays on as an editor. It reports false when newOwnerID
+// is not a collaborator on the story.
+func (s *service) TransferOwnership(ctx context.Context, storyID, newOwnerID primitive.ObjectID) (bool, error) {
+	story, err := s.GetStoryDetails(ctx, storyID)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	// Matching on the current owner guards against a concurrent transfer.
+	filter := primitive.M{"_id": storyID, "owner_id": story.OwnerID, "collaborators": newOwnerID}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: primitive.M{
+			"owner_id": newOwnerID,
+			"collaborators": primitive.M{"$concatArrays": primitive.A{
+				primitive.M{"$filter": primitive.M{
+					"input": "$collaborators",
+					"cond":  primitive.M{"$ne": primitive.A{"$$this", newOwnerID}},
+				}},
+				primitive.A{story.OwnerID},
+			}},
+			roleField(story.OwnerID): data.RoleEditor,
+			"updated_at":             time.Now(),
+		}}},
+		{{Key: "$unset", Value: roleField(newOwnerID)}},
+	}
+
+	res, err := s.storyDetails().UpdateOne(ctx, filter, pipeline)
+	if err != nil {
+		return false, fmt.Errorf("error transferring ownership: %v", err)
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+func roleField(userID primitive.ObjectID) string {
+	return "roles." + userID.Hex()
+}
+
+func (s *service) GetInvitations(ctx context.Context, userID primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter := notTrashed(primitive.M{"invitations": userID})
+
+	q := storyPageQuery(filter, page.Sort)
+	coll := s.storyDetails()
+	return findPage(ctx, coll, q, page, storyKey(q.sortField))
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mAmineChniti/StoryHub/internal/config"
+)
+
+// clientOptions turns the database settings into Mongo client options.
+// Settings given explicitly take precedence over the same ones in the URI.
+func clientOptions(cfg config.Database) (*options.ClientOptions, error) {
+	uri := cfg.URI
+	if uri == "" {
+		uri = fmt.Sprintf("mongodb+srv://%s:%s%s", cfg.Username, cfg.Password, cfg.ConnectionString)
+	}
+	opts := options.Client().ApplyURI(uri)
+
+	if opts.Auth == nil && cfg.Username != "" {
+		opts.SetAuth(options.Credential{Username: cfg.Username, Password: cfg.Password})
+	}
+	if cfg.AuthSource != "" {
+		if opts.Auth == nil {
+			return nil, fmt.Errorf("an auth source needs credentials to authenticate with")
+		}
+		opts.Auth.AuthSource = cfg.AuthSource
+	}
+
+	if cfg.TLS || cfg.TLSCAFile != "" {
+		tlsConfig, err := newTLSConfig(opts.TLSConfig, cfg.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	if cfg.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(cfg.MaxPoolSize)
+	}
+	if cfg.MinPoolSize > 0 {
+		opts.SetMinPoolSize(cfg.MinPoolSize)
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(cfg.MaxConnIdleTime)
+	}
+
+	return opts, nil
+}
+
+// newTLSConfig extends the TLS settings the URI asked for, if any, to trust
+// the certificates in caFile.
+func newTLSConfig(base *tls.Config, caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		tlsConfig = base.Clone()
+	}
+	if caFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading database CA file: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in database CA file %s", caFile)
+	}
+	tlsConfig.RootCAs = roots
+	return tlsConfig, nil
+}
@@ -0,0 +1,395 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// ConsistencyReport lists what half-applied forks, deletes and merges left
+// behind.
+// Transactions prevent these; see withTransaction for when they are not
+// available.
+type ConsistencyReport struct {
+	// OrphanedStories are deleted stories whose content, revisions or
+	// chapters are still stored.
+	OrphanedStories []primitive.ObjectID `json:"orphaned_stories"`
+	// MissingContent are stories with revisions but no content document.
+	MissingContent []primitive.ObjectID `json:"missing_content"`
+	// IncompleteForks are forks that were cut short while their content or
+	// chapters were being copied.
+	IncompleteForks []primitive.ObjectID `json:"incomplete_forks"`
+	// ForkCounts are stories whose fork count disagrees with their forks
+	// outside the trash.
+	ForkCounts []ForkCountDrift `json:"fork_counts"`
+	// UnappliedMerges are merge requests marked accepted without the
+	// revision that accepting them should have created.
+	UnappliedMerges []primitive.ObjectID `json:"unapplied_merges"`
+	// Repaired is set when the problems above have been fixed.
+	Repaired bool `json:"repaired"`
+}
+
+type ForkCountDrift struct {
+	StoryID  primitive.ObjectID `json:"story_id"`
+	Recorded int                `json:"recorded"`
+	Actual   int                `json:"actual"`
+}
+
+// Consistent reports whether the check found nothing to repair.
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.OrphanedStories) == 0 && len(r.MissingContent) == 0 && len(r.IncompleteForks) == 0 &&
+		len(r.ForkCounts) == 0 && len(r.UnappliedMerges) == 0
+}
+
+// consistencySnapshot is what a Service gathers for a consistency check.
+type consistencySnapshot struct {
+	// forkCounts maps every story to its recorded fork count.
+	forkCounts map[primitive.ObjectID]int
+	// forks maps every forked story to the number of its forks that are not
+	// in the trash.
+	forks map[primitive.ObjectID]int
+	// forkedFrom maps every fork to the story it was forked from.
+	forkedFrom map[primitive.ObjectID]primitive.ObjectID
+	// copiedForks are the forks that recorded copying a revision.
+	copiedForks map[primitive.ObjectID]bool
+	// The story IDs that content and chapters refer to.
+	content, chapters map[primitive.ObjectID]bool
+	// revisions counts the revisions of each story.
+	revisions map[primitive.ObjectID]int
+	// splitForks are the forks with chapters that do not add up to their
+	// content.
+	splitForks map[primitive.ObjectID]bool
+	// unappliedMerges are the accepted merge requests with no revision.
+	unappliedMerges []primitive.ObjectID
+}
+
+func (snapshot *consistencySnapshot) report() *ConsistencyReport {
+	report := &ConsistencyReport{
+		OrphanedStories: []primitive.ObjectID{},
+		MissingContent:  []primitive.ObjectID{},
+		IncompleteForks: []primitive.ObjectID{},
+		ForkCounts:      []ForkCountDrift{},
+		UnappliedMerges: append([]primitive.ObjectID{}, snapshot.unappliedMerges...),
+	}
+
+	orphaned := make(map[primitive.ObjectID]bool)
+	for _, refs := range []map[primitive.ObjectID]bool{snapshot.content, snapshot.chapters} {
+		for storyID := range refs {
+			if _, ok := snapshot.forkCounts[storyID]; !ok {
+				orphaned[storyID] = true
+			}
+		}
+	}
+	for storyID := range snapshot.revisions {
+		if _, ok := snapshot.forkCounts[storyID]; !ok {
+			orphaned[storyID] = true
+		}
+	}
+	for storyID := range orphaned {
+		report.OrphanedStories = append(report.OrphanedStories, storyID)
+	}
+
+	// A fork that recorded copying a revision but holds no content or
+	// revisions was cut off before its content was written. One nobody has
+	// edited since it was made whose chapters do not add up to its content
+	// was cut off while they were copied.
+	incomplete := make(map[primitive.ObjectID]bool)
+	for forkID, parentID := range snapshot.forkedFrom {
+		if _, ok := snapshot.forkCounts[parentID]; !ok || snapshot.revisions[forkID] > 1 {
+			continue
+		}
+		empty := snapshot.copiedForks[forkID] && snapshot.revisions[forkID] == 0 && !snapshot.content[forkID]
+		if empty || snapshot.splitForks[forkID] {
+			incomplete[forkID] = true
+			report.IncompleteForks = append(report.IncompleteForks, forkID)
+		}
+	}
+
+	for storyID := range snapshot.revisions {
+		_, exists := snapshot.forkCounts[storyID]
+		if exists && !snapshot.content[storyID] && !incomplete[storyID] {
+			report.MissingContent = append(report.MissingContent, storyID)
+		}
+	}
+
+	for storyID, recorded := range snapshot.forkCounts {
+		if actual := snapshot.forks[storyID]; recorded != actual {
+			report.ForkCounts = append(report.ForkCounts, ForkCountDrift{StoryID: storyID, Recorded: recorded, Actual: actual})
+		}
+	}
+
+	slices.SortFunc(report.OrphanedStories, compareIDs)
+	slices.SortFunc(report.MissingContent, compareIDs)
+	slices.SortFunc(report.IncompleteForks, compareIDs)
+	slices.SortFunc(report.UnappliedMerges, compareIDs)
+	slices.SortFunc(report.ForkCounts, func(a, b ForkCountDrift) int {
+		return compareIDs(a.StoryID, b.StoryID)
+	})
+	return report
+}
+
+// CheckConsistency looks for the leftovers of forks and deletes that failed
+// midway and, when repair is set, fixes them: orphaned content, revisions and
+// chapters are deleted, missing content is restored from the latest revision,
+// incomplete forks are given what forking them should have copied, fork counts are recounted and unapplied merges are reopened to be decided
+// again.
+func (s *service) CheckConsistency(ctx context.Context, repair bool) (*ConsistencyReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeouts.Background)
+	defer cancel()
+
+	snapshot, err := s.consistencySnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := snapshot.report()
+	if !repair || report.Consistent() {
+		return report, nil
+	}
+
+	if len(report.OrphanedStories) > 0 {
+		filter := primitive.M{"story_id": primitive.M{"$in": report.OrphanedStories}}
+		for _, coll := range []*mongo.Collection{s.storyContent(), s.storyRevisions(), s.storyChapters()} {
+			if _, err := coll.DeleteMany(ctx, filter); err != nil {
+				return nil, fmt.Errorf("error deleting orphaned %s: %v", coll.Name(), err)
+			}
+		}
+	}
+
+	for _, storyID := range report.MissingContent {
+		var latest struct {
+			ID      primitive.ObjectID `bson:"_id"`
+			Content string             `bson:"content"`
+		}
+		opts := options.FindOne().SetSort(primitive.D{{Key: "_id", Value: -1}})
+		if err := s.storyRevisions().FindOne(ctx, primitive.M{"story_id": storyID}, opts).Decode(&latest); err != nil {
+			return nil, fmt.Errorf("error fetching latest revision: %v", err)
+		}
+		if err := s.setContentHead(ctx, storyID, latest.ID, latest.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, forkID := range report.IncompleteForks {
+		err := s.withTransaction(ctx, func(ctx context.Context) error {
+			return s.recopyFork(ctx, forkID)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, drift := range report.ForkCounts {
+		update := primitive.M{"$set": primitive.M{"fork_count": drift.Actual}}
+		if _, err := s.storyDetails().UpdateOne(ctx, primitive.M{"_id": drift.StoryID}, update); err != nil {
+			return nil, fmt.Errorf("error updating fork count: %v", err)
+		}
+	}
+
+	if len(report.UnappliedMerges) > 0 {
+		_, err := s.mergeRequests().UpdateMany(ctx,
+			primitive.M{"_id": primitive.M{"$in": report.UnappliedMerges}},
+			primitive.M{
+				"$set":   primitive.M{"status": data.MergeRequestOpen, "updated_at": time.Now()},
+				"$unset": primitive.M{"decided_by": "", "decided_at": ""},
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error reopening merge requests: %v", err)
+		}
+	}
+
+	report.Repaired = true
+	return report, nil
+}
+
+func (s *service) consistencySnapshot(ctx context.Context) (*consistencySnapshot, error) {
+	snapshot := &consistencySnapshot{
+		forkCounts:  make(map[primitive.ObjectID]int),
+		forks:       make(map[primitive.ObjectID]int),
+		forkedFrom:  make(map[primitive.ObjectID]primitive.ObjectID),
+		copiedForks: make(map[primitive.ObjectID]bool),
+		revisions:   make(map[primitive.ObjectID]int),
+		splitForks:  make(map[primitive.ObjectID]bool),
+	}
+
+	cursor, err := s.storyDetails().Find(ctx, primitive.M{},
+		options.Find().SetProjection(primitive.M{"_id": 1, "fork_count": 1, "forked_from": 1, "fork_revision": 1, "deleted_at": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching stories: %v", err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var story struct {
+			ID           primitive.ObjectID `bson:"_id"`
+			ForkCount    int                `bson:"fork_count"`
+			ForkedFrom   primitive.ObjectID `bson:"forked_from"`
+			ForkRevision primitive.ObjectID `bson:"fork_revision"`
+			DeletedAt    *time.Time         `bson:"deleted_at"`
+		}
+		if err := cursor.Decode(&story); err != nil {
+			return nil, fmt.Errorf("error decoding story: %v", err)
+		}
+		snapshot.forkCounts[story.ID] = story.ForkCount
+		if story.ForkedFrom.IsZero() {
+			continue
+		}
+		snapshot.forkedFrom[story.ID] = story.ForkedFrom
+		snapshot.copiedForks[story.ID] = !story.ForkRevision.IsZero()
+		if story.DeletedAt == nil {
+			snapshot.forks[story.ForkedFrom]++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %v", err)
+	}
+
+	referenced := func(coll *mongo.Collection) (map[primitive.ObjectID]bool, error) {
+		ids, err := coll.Distinct(ctx, "story_id", primitive.M{})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %s story IDs: %v", coll.Name(), err)
+		}
+		refs := make(map[primitive.ObjectID]bool, len(ids))
+		for _, id := range ids {
+			if storyID, ok := id.(primitive.ObjectID); ok {
+				refs[storyID] = true
+			}
+		}
+		return refs, nil
+	}
+	if snapshot.content, err = referenced(s.storyContent()); err != nil {
+		return nil, err
+	}
+	if snapshot.chapters, err = referenced(s.storyChapters()); err != nil {
+		return nil, err
+	}
+
+	cursor, err = s.storyRevisions().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: primitive.M{"_id": "$story_id", "count": primitive.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting revisions: %v", err)
+	}
+	var revisionCounts []struct {
+		StoryID primitive.ObjectID `bson:"_id"`
+		Count   int                `bson:"count"`
+	}
+	if err := cursor.All(ctx, &revisionCounts); err != nil {
+		return nil, fmt.Errorf("error decoding revision counts: %v", err)
+	}
+	for _, count := range revisionCounts {
+		snapshot.revisions[count.StoryID] = count.Count
+	}
+
+	for forkID := range snapshot.forkedFrom {
+		if !snapshot.chapters[forkID] || snapshot.revisions[forkID] > 1 {
+			continue
+		}
+		split, err := s.chaptersDisagree(ctx, forkID)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.splitForks[forkID] = split
+	}
+
+	cursor, err = s.mergeRequests().Find(ctx,
+		primitive.M{"status": data.MergeRequestAccepted, "revision_id": primitive.M{"$exists": false}},
+		options.Find().SetProjection(primitive.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching unapplied merge requests: %v", err)
+	}
+	var unapplied []data.MergeRequest
+	if err := cursor.All(ctx, &unapplied); err != nil {
+		return nil, fmt.Errorf("error decoding unapplied merge requests: %v", err)
+	}
+	for _, request := range unapplied {
+		snapshot.unappliedMerges = append(snapshot.unappliedMerges, request.ID)
+	}
+
+	return snapshot, nil
+}
+
+// chaptersInOrder returns a story's chapters in reading order.
+func (s *service) chaptersInOrder(ctx context.Context, storyID primitive.ObjectID) ([]data.Chapter, error) {
+	findOptions := options.Find().SetSort(primitive.D{{Key: "order", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := s.storyChapters().Find(ctx, primitive.M{"story_id": storyID}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching chapters: %v", err)
+	}
+	var chapters []data.Chapter
+	if err := cursor.All(ctx, &chapters); err != nil {
+		return nil, fmt.Errorf("error decoding chapters: %v", err)
+	}
+	return chapters, nil
+}
+
+// chaptersDisagree reports whether a story's chapters, joined in reading
+// order, differ from its content.
+func (s *service) chaptersDisagree(ctx context.Context, storyID primitive.ObjectID) (bool, error) {
+	chapters, err := s.chaptersInOrder(ctx, storyID)
+	if err != nil {
+		return false, err
+	}
+
+	var content data.StoryContent
+	err = s.storyContent().FindOne(ctx, primitive.M{"story_id": storyID}).Decode(&content)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return false, fmt.Errorf("error fetching story content: %v", err)
+	}
+	return joinChapters(chapters) != content.Content, nil
+}
+
+// recopyFork gives a cut-short fork what forking it should have copied and
+// nothing newer. Missing content is taken from the revision the fork
+// recorded. The fork's chapters are copied again from its upstream only while
+// those still add up to its content; otherwise the fork is left with its
+// content and no chapters.
+func (s *service) recopyFork(ctx context.Context, forkID primitive.ObjectID) error {
+	var fork data.StoryDetails
+	if err := s.storyDetails().FindOne(ctx, primitive.M{"_id": forkID}).Decode(&fork); err != nil {
+		return fmt.Errorf("error fetching fork: %v", err)
+	}
+
+	var content data.StoryContent
+	err := s.storyContent().FindOne(ctx, primitive.M{"story_id": forkID}).Decode(&content)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return fmt.Errorf("error fetching story content: %v", err)
+	}
+	if content.Content == "" && !fork.ForkRevision.IsZero() {
+		var copied data.StoryRevision
+		err := s.storyRevisions().FindOne(ctx, primitive.M{"_id": fork.ForkRevision, "story_id": fork.ForkedFrom}).Decode(&copied)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return fmt.Errorf("error fetching story revision: %v", err)
+		}
+		if err == nil {
+			revisionID, err := s.insertRevision(ctx, forkID, fork.OwnerID, copied.Content, primitive.NilObjectID)
+			if err != nil {
+				return err
+			}
+			if err := s.setContentHead(ctx, forkID, revisionID, copied.Content); err != nil {
+				return err
+			}
+			content.Content = copied.Content
+		}
+	}
+
+	if _, err := s.storyChapters().DeleteMany(ctx, primitive.M{"story_id": forkID}); err != nil {
+		return fmt.Errorf("error clearing fork chapters: %v", err)
+	}
+	chapters, err := s.chaptersInOrder(ctx, fork.ForkedFrom)
+	if err != nil {
+		return err
+	}
+	if len(chapters) == 0 || joinChapters(chapters) != content.Content {
+		return nil
+	}
+	return s.copyChapters(ctx, fork.ForkedFrom, forkID)
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/config"
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+func TestCheckConsistencyForks(t *testing.T) {
+	const (
+		original = "The first draft of the story."
+		later    = "Written upstream after the fork."
+	)
+	owner, forker := primitive.NewObjectID(), primitive.NewObjectID()
+
+	// dropContent and dropChapter leave a fork the way a fork cut off before
+	// its content, or midway through its chapters, would.
+	dropContent := func(m *memory, forkID primitive.ObjectID) {
+		delete(m.contents, forkID)
+		maps.DeleteFunc(m.revisions, func(_ primitive.ObjectID, revision data.StoryRevision) bool {
+			return revision.StoryID == forkID
+		})
+		maps.DeleteFunc(m.chapters, func(_ primitive.ObjectID, chapter data.Chapter) bool {
+			return chapter.StoryID == forkID
+		})
+	}
+	dropChapter := func(m *memory, forkID primitive.ObjectID) {
+		chapters := m.storyChapters(forkID)
+		delete(m.chapters, chapters[len(chapters)-1].ID)
+	}
+
+	tests := []struct {
+		name string
+		// empty leaves the upstream without content when it is forked.
+		empty bool
+		// chapters splits the upstream into chapters instead of editing it.
+		chapters bool
+		// cutShort damages the fork the way a failed fork would.
+		cutShort func(m *memory, forkID primitive.ObjectID)
+		// afterwards changes the upstream once the fork is made.
+		afterwards     func(t *testing.T, m *memory, storyID primitive.ObjectID)
+		wantIncomplete bool
+		wantContent    string
+		wantChapters   int
+	}{
+		{name: "fork of an empty story", empty: true, wantContent: "",
+			afterwards: func(t *testing.T, m *memory, storyID primitive.ObjectID) {
+				if _, err := m.EditStoryContent(t.Context(), storyID, owner, later); err != nil {
+					t.Fatalf("EditStoryContent() error = %v", err)
+				}
+			}},
+		{name: "complete fork", chapters: true, wantContent: joinChapters([]data.Chapter{{Title: "One", Content: original}, {Title: "Two", Content: original}}), wantChapters: 2},
+		{name: "fork without content", cutShort: dropContent, wantIncomplete: true, wantContent: original,
+			afterwards: func(t *testing.T, m *memory, storyID primitive.ObjectID) {
+				if _, err := m.EditStoryContent(t.Context(), storyID, owner, later); err != nil {
+					t.Fatalf("EditStoryContent() error = %v", err)
+				}
+			}},
+		{name: "fork with missing chapters", chapters: true, cutShort: dropChapter, wantIncomplete: true,
+			wantContent: joinChapters([]data.Chapter{{Title: "One", Content: original}, {Title: "Two", Content: original}}), wantChapters: 2},
+		{name: "fork with missing chapters changed upstream", chapters: true, cutShort: dropChapter, wantIncomplete: true,
+			wantContent: joinChapters([]data.Chapter{{Title: "One", Content: original}, {Title: "Two", Content: original}}), wantChapters: 0,
+			afterwards: func(t *testing.T, m *memory, storyID primitive.ObjectID) {
+				if _, err := m.CreateChapter(t.Context(), storyID, owner, "Three", later); err != nil {
+					t.Fatalf("CreateChapter() error = %v", err)
+				}
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMemory(nil, config.Default().Database.Timeouts)
+			storyID, err := m.CreateStory(t.Context(), &data.StoryDetails{Title: "Upstream", Genre: "drama", OwnerID: owner})
+			if err != nil {
+				t.Fatalf("CreateStory() error = %v", err)
+			}
+			switch {
+			case tt.chapters:
+				for _, title := range []string{"One", "Two"} {
+					if _, err := m.CreateChapter(t.Context(), storyID, owner, title, original); err != nil {
+						t.Fatalf("CreateChapter() error = %v", err)
+					}
+				}
+			case !tt.empty:
+				if _, err := m.EditStoryContent(t.Context(), storyID, owner, original); err != nil {
+					t.Fatalf("EditStoryContent() error = %v", err)
+				}
+			}
+
+			forkID, err := m.ForkStory(t.Context(), storyID, forker)
+			if err != nil {
+				t.Fatalf("ForkStory() error = %v", err)
+			}
+			if tt.cutShort != nil {
+				tt.cutShort(m, forkID)
+			}
+			if tt.afterwards != nil {
+				tt.afterwards(t, m, storyID)
+			}
+
+			report, err := m.CheckConsistency(t.Context(), true)
+			if err != nil {
+				t.Fatalf("CheckConsistency() error = %v", err)
+			}
+			if got := slices.Contains(report.IncompleteForks, forkID); got != tt.wantIncomplete {
+				t.Errorf("fork reported incomplete = %v, want %v; report %+v", got, tt.wantIncomplete, report)
+			}
+			if content := m.contents[forkID].Content; content != tt.wantContent {
+				t.Errorf("fork content = %q, want %q", content, tt.wantContent)
+			}
+			if chapters := m.storyChapters(forkID); len(chapters) != tt.wantChapters {
+				t.Errorf("fork has %d chapters, want %d", len(chapters), tt.wantChapters)
+			}
+
+			if report, err := m.CheckConsistency(t.Context(), false); err != nil || !report.Consistent() {
+				t.Errorf("CheckConsistency() after repair = %+v, %v, want consistent", report, err)
+			}
+		})
+	}
+}
@@ -1,74 +1,171 @@
 package database
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	_ "github.com/joho/godotenv/autoload"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/mAmineChniti/StoryHub/internal/config"
 	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/users"
 )
 
 type Service interface {
-	CreateStory(req *data.StoryDetails) (primitive.ObjectID, error)
-	GetStoryDetails(id primitive.ObjectID) (*data.StoryDetails, error)
-	GetStoryContent(id primitive.ObjectID) (*data.StoryContent, error)
-	GetStories(page, limit int) ([]data.StoryDetails, error)
-	GetStoryCollaborators(id primitive.ObjectID) ([]primitive.ObjectID, error)
-	GetStoriesByFilters(genres []string, page, limit int) ([]data.StoryDetails, error)
-	GetStoriesByUser(userID primitive.ObjectID, page, limit int) ([]data.StoryDetails, error)
-	GetCollaborations(userID primitive.ObjectID, page, limit int) ([]data.StoryDetails, error)
-	EditStoryContent(id primitive.ObjectID, content string) (bool, error)
-	ForkStory(id primitive.ObjectID, userID primitive.ObjectID) (primitive.ObjectID, error)
-	DeleteStory(id primitive.ObjectID) (bool, error)
-	DeleteAllStoriesByUser(userID primitive.ObjectID) (bool, error)
-	Health() (map[string]string, error)
-	CleanupOrphanedStories() error
+	CreateStory(ctx context.Context, req *data.StoryDetails) (primitive.ObjectID, error)
+	GetStoryDetails(ctx context.Context, id primitive.ObjectID) (*data.StoryDetails, error)
+	GetStoryContent(ctx context.Context, id primitive.ObjectID) (*data.StoryContent, error)
+	GetStories(ctx context.Context, page data.PageRequest) (*data.Page[data.StoryDetails], error)
+	GetStoryCollaborators(ctx context.Context, id primitive.ObjectID) ([]primitive.ObjectID, error)
+	GetStoriesByFilters(ctx context.Context, genres []string, page data.PageRequest) (*data.Page[data.StoryDetails], error)
+	GetStoriesByUser(ctx context.Context, userID primitive.ObjectID, includeUnlisted bool, page data.PageRequest) (*data.Page[data.StoryDetails], error)
+	GetCollaborations(ctx context.Context, userID primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryDetails], error)
+	InviteCollaborator(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID, role data.Role) (bool, error)
+	RespondToInvitation(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID, accept bool) (bool, error)
+	RemoveCollaborator(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) (bool, error)
+	SetCollaboratorRole(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID, role data.Role) (bool, error)
+	TransferOwnership(ctx context.Context, id primitive.ObjectID, newOwnerID primitive.ObjectID) (bool, error)
+	GetInvitations(ctx context.Context, userID primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryDetails], error)
+	EditStoryContent(ctx context.Context, id primitive.ObjectID, authorID primitive.ObjectID, content string) (bool, error)
+	GetStoryRevisions(ctx context.Context, id primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryRevision], error)
+	GetStoryRevision(ctx context.Context, id primitive.ObjectID, revisionID primitive.ObjectID) (*data.StoryRevision, error)
+	RestoreStoryRevision(ctx context.Context, id primitive.ObjectID, revisionID primitive.ObjectID, userID primitive.ObjectID) (primitive.ObjectID, error)
+	CreateMergeRequest(ctx context.Context, req *data.MergeRequest) (primitive.ObjectID, error)
+	GetMergeRequest(ctx context.Context, id primitive.ObjectID) (*data.MergeRequest, error)
+	GetMergeRequests(ctx context.Context, storyID primitive.ObjectID, status data.MergeRequestStatus, page data.PageRequest) (*data.Page[data.MergeRequest], error)
+	AddMergeComment(ctx context.Context, id primitive.ObjectID, authorID primitive.ObjectID, body string) (primitive.ObjectID, error)
+	AcceptMergeRequest(ctx context.Context, id primitive.ObjectID, reviewerID primitive.ObjectID) (primitive.ObjectID, error)
+	RejectMergeRequest(ctx context.Context, id primitive.ObjectID, reviewerID primitive.ObjectID) (bool, error)
+	SetStoryVisibility(ctx context.Context, id primitive.ObjectID, visibility data.Visibility) (bool, error)
+	UpdateStoryMetadata(ctx context.Context, id primitive.ObjectID, metadata data.StoryMetadata) (bool, error)
+	PublishStory(ctx context.Context, id primitive.ObjectID) (bool, error)
+	ScheduleStory(ctx context.Context, id primitive.ObjectID, publishAt time.Time) (bool, error)
+	UnpublishStory(ctx context.Context, id primitive.ObjectID, status data.PublicationStatus) (bool, error)
+	PublishScheduledStories(ctx context.Context) (int64, error)
+	CreateChapter(ctx context.Context, id primitive.ObjectID, authorID primitive.ObjectID, title, content string) (primitive.ObjectID, error)
+	GetChapters(ctx context.Context, id primitive.ObjectID) ([]data.Chapter, error)
+	GetChapter(ctx context.Context, id primitive.ObjectID, chapterID primitive.ObjectID) (*data.Chapter, error)
+	CountChapters(ctx context.Context, id primitive.ObjectID) (int64, error)
+	EditChapter(ctx context.Context, id primitive.ObjectID, chapterID primitive.ObjectID, authorID primitive.ObjectID, title, content *string) (bool, error)
+	DeleteChapter(ctx context.Context, id primitive.ObjectID, chapterID primitive.ObjectID, authorID primitive.ObjectID) (bool, error)
+	ReorderChapters(ctx context.Context, id primitive.ObjectID, authorID primitive.ObjectID, chapterIDs []primitive.ObjectID) (bool, error)
+	ForkStory(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) (primitive.ObjectID, error)
+	GetForks(ctx context.Context, id primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryDetails], error)
+	GetAncestors(ctx context.Context, id primitive.ObjectID) ([]data.StoryDetails, error)
+	GetForkTree(ctx context.Context, id primitive.ObjectID, depth int) (*data.ForkNode, error)
+	DeleteStory(ctx context.Context, id primitive.ObjectID) (bool, error)
+	DeleteAllStoriesByUser(ctx context.Context, userID primitive.ObjectID) (bool, error)
+	GetTrash(ctx context.Context, userID primitive.ObjectID, retention time.Duration, page data.PageRequest) (*data.Page[data.StoryDetails], error)
+	GetTrashedStory(ctx context.Context, id primitive.ObjectID, retention time.Duration) (*data.StoryDetails, error)
+	RestoreStory(ctx context.Context, id primitive.ObjectID, retention time.Duration) (bool, error)
+	PurgeTrash(ctx context.Context, retention time.Duration) (int64, error)
+	Health(ctx context.Context) (map[string]string, error)
+	CleanupOrphanedStories(ctx context.Context, opts CleanupOptions) (*CleanupReport, error)
+	LastCleanupReport() *CleanupReport
+	CheckConsistency(ctx context.Context, repair bool) (*ConsistencyReport, error)
 }
 
 type service struct {
-	db *mongo.Client
+	db          *mongo.Client
+	database    *mongo.Database
+	collections config.Collections
+	timeouts    config.Timeouts
+	// transactions is set when the deployment is a replica set or sharded
+	// cluster, the only kinds that support multi-document transactions.
+	transactions bool
+	// directory tells orphan cleanup which story owners still exist.
+	directory users.Directory
+	cleanups  cleanupRuns
 }
 
-var (
-	dbUsername       = os.Getenv("DB_USERNAME")
-	dbPassword       = os.Getenv("DB_PASSWORD")
-	connectionString = os.Getenv("DB_CONNECTION_STRING")
-)
+// withTimeout bounds a single operation by the configured timeout as well as
+// by ctx, which is usually the HTTP request's.
+func (s *service) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.timeouts.Operation)
+}
+
+func (s *service) storyDetails() *mongo.Collection {
+	return s.database.Collection(s.collections.StoryDetails)
+}
+
+func (s *service) storyContent() *mongo.Collection {
+	return s.database.Collection(s.collections.StoryContent)
+}
+
+func (s *service) storyRevisions() *mongo.Collection {
+	return s.database.Collection(s.collections.StoryRevisions)
+}
+
+func (s *service) storyChapters() *mongo.Collection {
+	return s.database.Collection(s.collections.StoryChapters)
+}
 
-func New() Service {
-	uri := fmt.Sprintf("mongodb+srv://%s:%s%s", dbUsername, dbPassword, connectionString)
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+func (s *service) mergeRequests() *mongo.Collection {
+	return s.database.Collection(s.collections.MergeRequests)
+}
+
+// New returns the Service selected by cfg.Driver. directory is what
+// CleanupOrphanedStories asks about story owners.
+func New(cfg config.Database, directory users.Directory) Service {
+	if cfg.Driver == config.DriverMemory {
+		log.Println("Using the in-memory database, data will not survive a restart")
+		return newMemory(directory, cfg.Timeouts)
+	}
 
+	opts, err := clientOptions(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := mongo.Connect(context.Background(), opts)
 	if err != nil {
 		log.Fatal(err)
+	}
+	s := &service{
+		db:          client,
+		database:    client.Database(cfg.Name),
+		collections: cfg.Collections,
+		timeouts:    cfg.Timeouts,
+		directory:   directory,
+	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Startup)
+	defer cancel()
+	if err := s.createIndexes(ctx); err != nil {
+		log.Printf("Error creating indexes: %v", err)
 	}
-	return &service{
-		db: client,
+
+	s.transactions, err = supportsTransactions(ctx, client)
+	if err != nil {
+		log.Printf("Error checking for transaction support: %v", err)
+	}
+	if !s.transactions {
+		log.Println("The database does not support transactions, forks and deletes run without them")
 	}
+
+	return s
 }
 
-func (s *service) CreateStory(req *data.StoryDetails) (primitive.ObjectID, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) CreateStory(ctx context.Context, req *data.StoryDetails) (primitive.ObjectID, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
 	req.CreatedAt = time.Now()
 	req.UpdatedAt = time.Now()
+	if req.Visibility == "" {
+		req.Visibility = data.VisibilityPublic
+	}
+	if req.Status == "" {
+		req.Status = data.StatusPublished
+	}
+	if req.Status == data.StatusPublished && req.PublishedAt == nil {
+		req.PublishedAt = &req.CreatedAt
+	}
 
-	res, err := s.db.Database("storyhub").Collection("storydetails").InsertOne(ctx, req)
+	res, err := s.storyDetails().InsertOne(ctx, req)
 	if err != nil {
 		return primitive.NilObjectID, fmt.Errorf("error inserting story: %v", err)
 	}
@@ -76,12 +173,15 @@ func (s *service) CreateStory(req *data.StoryDetails) (primitive.ObjectID, error
 	return res.InsertedID.(primitive.ObjectID), nil
 }
 
-func (s *service) GetStoryDetails(id primitive.ObjectID) (*data.StoryDetails, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) GetStoryDetails(ctx context.Context, id primitive.ObjectID) (*data.StoryDetails, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
 	var story data.StoryDetails
-	err := s.db.Database("storyhub").Collection("storydetails").FindOne(ctx, primitive.M{"_id": id}).Decode(&story)
+	err := s.storyDetails().FindOne(ctx, notTrashed(primitive.M{"_id": id})).Decode(&story)
+	if err == mongo.ErrNoDocuments {
+		return nil, notFound("story not found")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error fetching story: %v", err)
 	}
@@ -89,18 +189,21 @@ func (s *service) GetStoryDetails(id primitive.ObjectID) (*data.StoryDetails, er
 	return &story, nil
 }
 
-func (s *service) GetStoryContent(id primitive.ObjectID) (*data.StoryContent, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) GetStoryContent(ctx context.Context, id primitive.ObjectID) (*data.StoryContent, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
 	var story data.StoryDetails
-	err := s.db.Database("storyhub").Collection("storydetails").FindOne(ctx, primitive.M{"_id": id}).Decode(&story)
+	err := s.storyDetails().FindOne(ctx, notTrashed(primitive.M{"_id": id})).Decode(&story)
+	if err == mongo.ErrNoDocuments {
+		return nil, notFound("story not found")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("story not found")
+		return nil, fmt.Errorf("error fetching story: %v", err)
 	}
 
 	var content data.StoryContent
-	err = s.db.Database("storyhub").Collection("storycontent").FindOne(ctx, primitive.M{"story_id": id}).Decode(&content)
+	err = s.storyContent().FindOne(ctx, primitive.M{"story_id": id}).Decode(&content)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return &data.StoryContent{
@@ -113,165 +216,212 @@ func (s *service) GetStoryContent(id primitive.ObjectID) (*data.StoryContent, er
 	return &content, nil
 }
 
-func (s *service) GetStories(page, limit int) ([]data.StoryDetails, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) GetStories(ctx context.Context, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	skip := (page - 1) * limit
-	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit))
-
-	cursor, err := s.db.Database("storyhub").Collection("storydetails").Find(ctx, primitive.M{}, findOptions)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching stories: %v", err)
-	}
-	defer cursor.Close(ctx)
-
-	var stories []data.StoryDetails
-	if err := cursor.All(ctx, &stories); err != nil {
-		return nil, fmt.Errorf("error decoding stories: %v", err)
-	}
+	q := storyPageQuery(listedFilter(), page.Sort)
+	coll := s.storyDetails()
+	return findPage(ctx, coll, q, page, storyKey(q.sortField))
+}
 
-	return stories, nil
+// listedFilter matches stories that may appear in public listings. Stories
+// saved before visibility or publication status existed have no value and
+// count as public and published.
+func listedFilter() primitive.M {
+	return notTrashed(primitive.M{
+		"visibility": primitive.M{"$in": primitive.A{data.VisibilityPublic, nil}},
+		"status":     primitive.M{"$in": primitive.A{data.StatusPublished, nil}},
+	})
 }
 
-func (s *service) GetStoryCollaborators(id primitive.ObjectID) ([]primitive.ObjectID, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) GetStoryCollaborators(ctx context.Context, id primitive.ObjectID) ([]primitive.ObjectID, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 	var story data.StoryDetails
-	err := s.db.Database("storyhub").Collection("storydetails").FindOne(ctx, primitive.M{"_id": id}).Decode(&story)
+	err := s.storyDetails().FindOne(ctx, notTrashed(primitive.M{"_id": id})).Decode(&story)
+	if err == mongo.ErrNoDocuments {
+		return nil, notFound("story not found")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error fetching story: %v", err)
 	}
 	return story.Collaborators, nil
 }
 
-func (s *service) GetStoriesByFilters(genres []string, page, limit int) ([]data.StoryDetails, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) GetStoriesByFilters(ctx context.Context, genres []string, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	filter := primitive.M{}
+	filter := listedFilter()
 	if len(genres) > 0 {
 		filter["genre"] = primitive.M{"$in": genres}
 	}
 
-	skip := (page - 1) * limit
-	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit))
+	q := storyPageQuery(filter, page.Sort)
+	coll := s.storyDetails()
+	return findPage(ctx, coll, q, page, storyKey(q.sortField))
+}
 
-	cursor, err := s.db.Database("storyhub").Collection("storydetails").Find(ctx, filter, findOptions)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching stories: %v", err)
-	}
-	defer cursor.Close(ctx)
+// GetStoriesByUser lists the stories owned by userID. Only public stories are
+// returned unless includeUnlisted is set, which is meant for the owner.
+func (s *service) GetStoriesByUser(ctx context.Context, userID primitive.ObjectID, includeUnlisted bool, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	var stories []data.StoryDetails
-	if err := cursor.All(ctx, &stories); err != nil {
-		return nil, fmt.Errorf("error decoding stories: %v", err)
+	filter := notTrashed(primitive.M{"owner_id": userID})
+	if !includeUnlisted {
+		filter = listedFilter()
+		filter["owner_id"] = userID
 	}
 
-	return stories, nil
+	q := storyPageQuery(filter, page.Sort)
+	coll := s.storyDetails()
+	return findPage(ctx, coll, q, page, storyKey(q.sortField))
 }
 
-func (s *service) GetStoriesByUser(userID primitive.ObjectID, page, limit int) ([]data.StoryDetails, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) GetCollaborations(ctx context.Context, userID primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	skip := (page - 1) * limit
-	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit))
-	filter := primitive.M{"owner_id": userID}
-	cursor, err := s.db.Database("storyhub").Collection("storydetails").Find(ctx, filter, findOptions)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching stories: %v", err)
-	}
-	defer cursor.Close(ctx)
-	var stories []data.StoryDetails
-	if err := cursor.All(ctx, &stories); err != nil {
-		return nil, fmt.Errorf("error decoding stories: %v", err)
-	}
-	return stories, nil
+	filter := notTrashed(primitive.M{"collaborators": primitive.M{"$in": []primitive.ObjectID{userID}}})
+
+	q := storyPageQuery(filter, page.Sort)
+	coll := s.storyDetails()
+	return findPage(ctx, coll, q, page, storyKey(q.sortField))
 }
 
-func (s *service) GetCollaborations(userID primitive.ObjectID, page, limit int) ([]data.StoryDetails, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) EditStoryContent(ctx context.Context, storyID, authorID primitive.ObjectID, newContent string) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	skip := (page - 1) * limit
-	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit))
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		_, err := s.editStoryContent(ctx, storyID, authorID, newContent)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	filter := primitive.M{"collaborators": primitive.M{"$in": []primitive.ObjectID{userID}}}
+// editStoryContent records newContent as a revision by authorID, makes it the
+// story's current content and returns the revision's ID.
+func (s *service) editStoryContent(ctx context.Context, storyID, authorID primitive.ObjectID, newContent string) (primitive.ObjectID, error) {
+	var story data.StoryDetails
+	err := s.storyDetails().FindOne(ctx, primitive.M{"_id": storyID}).Decode(&story)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, notFound("story not found")
+	}
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error fetching story: %v", err)
+	}
 
-	cursor, err := s.db.Database("storyhub").Collection("storydetails").Find(ctx, filter, findOptions)
+	if err := s.baselineRevision(ctx, storyID); err != nil {
+		return primitive.NilObjectID, err
+	}
+	revisionID, err := s.insertRevision(ctx, storyID, authorID, newContent, primitive.NilObjectID)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching stories: %v", err)
+		return primitive.NilObjectID, err
+	}
+
+	if err := s.setContentHead(ctx, storyID, revisionID, newContent); err != nil {
+		return primitive.NilObjectID, err
 	}
-	defer cursor.Close(ctx)
 
-	var stories []data.StoryDetails
-	if err := cursor.All(ctx, &stories); err != nil {
-		return nil, fmt.Errorf("error decoding stories: %v", err)
+	_, err = s.storyDetails().UpdateOne(ctx, primitive.M{"_id": storyID}, primitive.M{"$set": primitive.M{"updated_at": time.Now()}})
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error updating story details: %v", err)
 	}
 
-	return stories, nil
+	return revisionID, nil
 }
 
-func (s *service) EditStoryContent(storyID primitive.ObjectID, newContent string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) SetStoryVisibility(ctx context.Context, storyID primitive.ObjectID, visibility data.Visibility) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	var story data.StoryDetails
-	err := s.db.Database("storyhub").Collection("storydetails").FindOne(ctx, primitive.M{"_id": storyID}).Decode(&story)
+	filter := primitive.M{"_id": storyID}
+	update := primitive.M{"$set": primitive.M{"visibility": visibility, "updated_at": time.Now()}}
+
+	res, err := s.storyDetails().UpdateOne(ctx, filter, update)
 	if err != nil {
-		return false, fmt.Errorf("story not found")
+		return false, fmt.Errorf("error updating story visibility: %v", err)
 	}
 
-	filterContent := primitive.M{"story_id": storyID}
-	updateContent := primitive.M{"$set": primitive.M{"content": newContent}}
+	return res.MatchedCount > 0, nil
+}
 
-	res, err := s.db.Database("storyhub").Collection("storycontent").UpdateOne(ctx, filterContent, updateContent)
-	if err != nil {
-		return false, fmt.Errorf("error updating story content: %v", err)
-	}
+// UpdateStoryMetadata replaces the story's title, genre and description. It
+// reports false when the story does not exist or is in the trash.
+func (s *service) UpdateStoryMetadata(ctx context.Context, storyID primitive.ObjectID, metadata data.StoryMetadata) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	if res.MatchedCount == 0 {
-		newStoryContent := data.StoryContent{
-			StoryID: storyID,
-			Content: newContent,
-		}
-		_, err := s.db.Database("storyhub").Collection("storycontent").InsertOne(ctx, newStoryContent)
-		if err != nil {
-			return false, fmt.Errorf("error inserting new story content: %v", err)
-		}
-	}
+	filter := notTrashed(primitive.M{"_id": storyID})
+	update := primitive.M{"$set": primitive.M{
+		"title":       metadata.Title,
+		"genre":       metadata.Genre,
+		"description": metadata.Description,
+		"updated_at":  time.Now(),
+	}}
 
-	_, err = s.db.Database("storyhub").Collection("storydetails").UpdateOne(ctx, primitive.M{"_id": storyID}, primitive.M{"$set": primitive.M{"updated_at": time.Now()}})
+	res, err := s.storyDetails().UpdateOne(ctx, filter, update)
 	if err != nil {
-		return false, fmt.Errorf("error updating story details: %v", err)
+		return false, fmt.Errorf("error updating story metadata: %v", err)
 	}
 
-	return true, nil
+	return res.MatchedCount > 0, nil
 }
 
-func (s *service) ForkStory(storyID, userID primitive.ObjectID) (primitive.ObjectID, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) ForkStory(ctx context.Context, storyID, userID primitive.ObjectID) (primitive.ObjectID, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	story, err := s.GetStoryDetails(storyID)
+	var forkID primitive.ObjectID
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		forkID, err = s.forkStory(ctx, storyID, userID)
+		return err
+	})
 	if err != nil {
-		return primitive.NilObjectID, fmt.Errorf("story not found: %v", err)
+		return primitive.NilObjectID, err
 	}
+	return forkID, nil
+}
 
-	filter := bson.M{
+// forkStory copies a story's details, content and chapters for userID.
+func (s *service) forkStory(ctx context.Context, storyID, userID primitive.ObjectID) (primitive.ObjectID, error) {
+	story, err := s.GetStoryDetails(ctx, storyID)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// A fork in the trash does not stop its owner forking the story again.
+	filter := notTrashed(bson.M{
 		"forked_from": storyID,
 		"owner_id":    userID,
-	}
+	})
 	var existingFork data.StoryDetails
-	err = s.db.Database("storyhub").Collection("storydetails").FindOne(ctx, filter).Decode(&existingFork)
+	err = s.storyDetails().FindOne(ctx, filter).Decode(&existingFork)
 	if err == nil {
-		return primitive.NilObjectID, fmt.Errorf("you have already forked this story")
+		return primitive.NilObjectID, conflict("you have already forked this story")
 	}
 	if err != mongo.ErrNoDocuments {
 		return primitive.NilObjectID, fmt.Errorf("error checking existing forks: %v", err)
 	}
 
+	// The content is read before the fork is written, so a missing one
+	// cannot leave a fork behind. Content from before revisions first gets
+	// one for the fork to record.
+	if err := s.baselineRevision(ctx, storyID); err != nil {
+		return primitive.NilObjectID, err
+	}
+	storyContent, err := s.GetStoryContent(ctx, storyID)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error getting story content: %v", err)
+	}
+
 	forkedStory := &data.StoryDetails{
 		ID:            primitive.ObjectID{},
 		OwnerID:       userID,
@@ -279,220 +429,184 @@ func (s *service) ForkStory(storyID, userID primitive.ObjectID) (primitive.Objec
 		Description:   story.Description,
 		Genre:         story.Genre,
 		Collaborators: []primitive.ObjectID{},
+		Visibility:    story.EffectiveVisibility(),
+		Status:        data.StatusPublished,
 		ForkedFrom:    story.ID,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
+	// Forking a draft must not publish it behind the owner's back.
+	if story.EffectiveStatus() == data.StatusDraft {
+		forkedStory.Status = data.StatusDraft
+	}
+	if storyContent.Content != "" {
+		forkedStory.ForkRevision = storyContent.RevisionID
+	}
 
-	inserted_story_id, err := s.CreateStory(forkedStory)
+	inserted_story_id, err := s.CreateStory(ctx, forkedStory)
 	if err != nil {
 		return primitive.NilObjectID, fmt.Errorf("error creating forked story: %v", err)
 	}
 
-	storyContent, err := s.GetStoryContent(storyID)
+	_, err = s.storyDetails().UpdateOne(ctx, primitive.M{"_id": storyID}, primitive.M{"$inc": primitive.M{"fork_count": 1}})
 	if err != nil {
-		return primitive.NilObjectID, fmt.Errorf("error getting story content: %v", err)
+		return primitive.NilObjectID, fmt.Errorf("error updating fork count: %v", err)
 	}
 
 	if storyContent.Content != "" {
+		revisionID, err := s.insertRevision(ctx, inserted_story_id, userID, storyContent.Content, primitive.NilObjectID)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+
 		forkedStoryContent := &data.StoryContent{
-			ID:      primitive.ObjectID{},
-			StoryID: inserted_story_id,
-			Content: storyContent.Content,
+			ID:         primitive.ObjectID{},
+			StoryID:    inserted_story_id,
+			Content:    storyContent.Content,
+			RevisionID: revisionID,
 		}
 
-		_, err = s.db.Database("storyhub").Collection("storycontent").InsertOne(ctx, forkedStoryContent)
+		_, err = s.storyContent().InsertOne(ctx, forkedStoryContent)
 		if err != nil {
-			return inserted_story_id, fmt.Errorf("error inserting story content: %v", err)
+			return primitive.NilObjectID, fmt.Errorf("error inserting story content: %v", err)
 		}
 	}
+
+	if err := s.copyChapters(ctx, storyID, inserted_story_id); err != nil {
+		return primitive.NilObjectID, err
+	}
 	return inserted_story_id, nil
 }
 
-func (s *service) DeleteStory(storyID primitive.ObjectID) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// DeleteStory moves a story to the trash, where RestoreStory can bring it
+// back until PurgeTrash deletes it for good. A trashed fork stops counting
+// towards its parent.
+func (s *service) DeleteStory(ctx context.Context, storyID primitive.ObjectID) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	filter := primitive.M{"_id": storyID}
-	res, err := s.db.Database("storyhub").Collection("storydetails").DeleteOne(ctx, filter)
-	if err != nil {
-		return false, fmt.Errorf("error deleting story: %v", err)
-	}
-	if res.DeletedCount == 0 {
-		return false, fmt.Errorf("story not found")
-	}
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		var trashed data.StoryDetails
+		update := primitive.M{"$set": primitive.M{"deleted_at": time.Now()}}
+		err := s.storyDetails().FindOneAndUpdate(ctx, notTrashed(primitive.M{"_id": storyID}), update).Decode(&trashed)
+		if err == mongo.ErrNoDocuments {
+			return notFound("story not found")
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting story: %v", err)
+		}
 
-	filterContent := primitive.M{"story_id": storyID}
-	contentDel, err := s.db.Database("storyhub").Collection("storycontent").DeleteOne(ctx, filterContent)
+		return s.releaseForks(ctx, []data.StoryDetails{trashed})
+	})
 	if err != nil {
-		return false, fmt.Errorf("error deleting story content: %v", err)
-	}
-	if contentDel.DeletedCount == 0 {
-		log.Printf("story content not found")
+		return false, err
 	}
 
 	return true, nil
 }
 
-func (s *service) DeleteAllStoriesByUser(userID primitive.ObjectID) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	filter := primitive.M{"owner_id": userID}
-	cursor, err := s.db.Database("storyhub").Collection("storydetails").Find(ctx, filter)
-	if err != nil {
-		return false, fmt.Errorf("error finding user stories: %v", err)
+// deleteStoryData removes everything that hangs off stories whose details
+// were just deleted: their content, revisions, chapters and merge requests,
+// and their share of their parents' fork counts if they still held one.
+func (s *service) deleteStoryData(ctx context.Context, deleted []data.StoryDetails) error {
+	if err := s.releaseForks(ctx, deleted); err != nil {
+		return err
 	}
-	defer cursor.Close(ctx)
 
-	var storyIDs []primitive.ObjectID
-	for cursor.Next(ctx) {
-		var story data.StoryDetails
-		if err := cursor.Decode(&story); err != nil {
-			return false, fmt.Errorf("error decoding story: %v", err)
-		}
+	storyIDs := make([]primitive.ObjectID, 0, len(deleted))
+	for _, story := range deleted {
 		storyIDs = append(storyIDs, story.ID)
 	}
+	filter := primitive.M{"story_id": primitive.M{"$in": storyIDs}}
 
-	if len(storyIDs) == 0 {
-		return true, nil
+	if _, err := s.storyContent().DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("error deleting story contents: %v", err)
 	}
-
-	_, err = s.db.Database("storyhub").Collection("storydetails").DeleteMany(ctx, primitive.M{"owner_id": userID})
-	if err != nil {
-		return false, fmt.Errorf("error deleting story details: %v", err)
+	if _, err := s.storyRevisions().DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("error deleting story revisions: %v", err)
 	}
-
-	_, err = s.db.Database("storyhub").Collection("storycontent").DeleteMany(ctx, primitive.M{"story_id": primitive.M{"$in": storyIDs}})
-	if err != nil {
-		return false, fmt.Errorf("error deleting story contents: %v", err)
+	if _, err := s.storyChapters().DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("error deleting story chapters: %v", err)
 	}
-
-	return true, nil
-}
-
-func (s *service) Health() (map[string]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	err := s.db.Ping(ctx, nil)
-	if err != nil {
-		return nil, err
+	mergeFilter := primitive.M{"$or": primitive.A{
+		primitive.M{"story_id": primitive.M{"$in": storyIDs}},
+		primitive.M{"fork_id": primitive.M{"$in": storyIDs}},
+	}}
+	if _, err := s.mergeRequests().DeleteMany(ctx, mergeFilter); err != nil {
+		return fmt.Errorf("error deleting merge requests: %v", err)
 	}
 
-	return map[string]string{
-		"status": "ok",
-	}, nil
+	return nil
 }
 
-func (s *service) CleanupOrphanedStories() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	distinctResult, err := s.db.Database("storyhub").Collection("storydetails").Distinct(ctx, "owner_id", bson.M{})
-	if err != nil {
-		return fmt.Errorf("error fetching unique owner IDs: %v", err)
+// releaseForks decrements the fork count of the parents of deleted stories.
+// Stories that were already in the trash released theirs when they were
+// trashed.
+func (s *service) releaseForks(ctx context.Context, deleted []data.StoryDetails) error {
+	forks := make(map[primitive.ObjectID]int)
+	for _, story := range deleted {
+		if !story.ForkedFrom.IsZero() && !story.Trashed() {
+			forks[story.ForkedFrom]++
+		}
 	}
 
-	var ownerIDs []primitive.ObjectID
-	for _, id := range distinctResult {
-		if objID, ok := id.(primitive.ObjectID); ok {
-			ownerIDs = append(ownerIDs, objID)
+	for parentID, count := range forks {
+		filter := primitive.M{"_id": parentID}
+		update := primitive.M{"$inc": primitive.M{"fork_count": -count}}
+		if _, err := s.storyDetails().UpdateOne(ctx, filter, update); err != nil {
+			return fmt.Errorf("error updating fork count: %v", err)
 		}
 	}
 
-	var orphanedOwnerIDs []primitive.ObjectID
-	for _, ownerID := range ownerIDs {
-		userCheckURL := "https://gordian.onrender.com/api/v1/fetchuserbyid"
-		req, err := http.NewRequestWithContext(ctx, "POST", userCheckURL, nil)
-		if err != nil {
-			return fmt.Errorf("error creating request: %v", err)
-		}
+	return nil
+}
 
-		reqBody, err := json.Marshal(map[string]string{
-			"user_id": ownerID.Hex(),
-		})
-		if err != nil {
-			return fmt.Errorf("error marshaling request body: %v", err)
-		}
-		req.Body = io.NopCloser(bytes.NewBuffer(reqBody))
-		req.Header.Set("Content-Type", "application/json")
-
-		now := time.Now()
-		accessClaims := &jwt.RegisteredClaims{
-			Subject:   ownerID.Hex(),
-			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(now),
-			ID:        "access",
-		}
+// DeleteAllStoriesByUser moves every story userID owns to the trash.
+func (s *service) DeleteAllStoriesByUser(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-		jwtSecret := []byte(os.Getenv("JWTSECRET"))
-		tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims).SignedString(jwtSecret)
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		cursor, err := s.storyDetails().Find(ctx, notTrashed(primitive.M{"owner_id": userID}))
 		if err != nil {
-			return fmt.Errorf("error generating JWT token: %v", err)
-		}
-
-		req.Header.Set("Authorization", "Bearer "+tokenString)
-
-		client := &http.Client{
-			Timeout: 10 * time.Second,
+			return fmt.Errorf("error finding user stories: %v", err)
 		}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("Error checking user %s: %v", ownerID.Hex(), err)
-			continue
+		var stories []data.StoryDetails
+		if err := cursor.All(ctx, &stories); err != nil {
+			return fmt.Errorf("error decoding story: %v", err)
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode == http.StatusNotFound {
-			orphanedOwnerIDs = append(orphanedOwnerIDs, ownerID)
-		} else if resp.StatusCode != http.StatusOK {
-			log.Printf("Unexpected status checking user %s: %d", ownerID.Hex(), resp.StatusCode)
+		if len(stories) == 0 {
+			return nil
 		}
-	}
 
-	if len(orphanedOwnerIDs) > 0 {
-		cursor, err := s.db.Database("storyhub").Collection("storydetails").Find(ctx,
-			bson.M{"owner_id": bson.M{"$in": orphanedOwnerIDs}},
-			options.Find().SetProjection(bson.M{"_id": 1}),
-		)
-		if err != nil {
-			return fmt.Errorf("error finding orphaned story IDs: %v", err)
+		storyIDs := make([]primitive.ObjectID, 0, len(stories))
+		for _, story := range stories {
+			storyIDs = append(storyIDs, story.ID)
 		}
-		defer cursor.Close(ctx)
-
-		var orphanedStoryIDs []primitive.ObjectID
-		for cursor.Next(ctx) {
-			var result bson.M
-			if err := cursor.Decode(&result); err != nil {
-				return fmt.Errorf("error decoding cursor result: %v", err)
-			}
-			if id, ok := result["_id"].(primitive.ObjectID); ok {
-				orphanedStoryIDs = append(orphanedStoryIDs, id)
-			}
+		update := primitive.M{"$set": primitive.M{"deleted_at": time.Now()}}
+		if _, err := s.storyDetails().UpdateMany(ctx, primitive.M{"_id": primitive.M{"$in": storyIDs}}, update); err != nil {
+			return fmt.Errorf("error deleting story details: %v", err)
 		}
 
-		if err := cursor.Err(); err != nil {
-			return fmt.Errorf("cursor error: %v", err)
-		}
+		return s.releaseForks(ctx, stories)
+	})
+	if err != nil {
+		return false, err
+	}
 
-		_, err = s.db.Database("storyhub").Collection("storydetails").DeleteMany(ctx, bson.M{"owner_id": bson.M{"$in": orphanedOwnerIDs}})
-		if err != nil {
-			return fmt.Errorf("error deleting orphaned stories: %v", err)
-		}
+	return true, nil
+}
 
-		_, err = s.db.Database("storyhub").Collection("storycontent").DeleteMany(ctx, bson.M{"story_id": bson.M{"$in": orphanedStoryIDs}})
-		if err != nil {
-			return fmt.Errorf("error deleting orphaned story contents: %v", err)
-		}
+func (s *service) Health(ctx context.Context) (map[string]string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-		_, err = s.db.Database("storyhub").Collection("storydetails").UpdateMany(ctx,
-			bson.M{"collaborators": bson.M{"$in": orphanedOwnerIDs}},
-			bson.M{"$pull": bson.M{"collaborators": bson.M{"$in": orphanedOwnerIDs}}},
-		)
-		if err != nil {
-			return fmt.Errorf("error removing orphaned users from collaborators: %v", err)
-		}
+	err := s.db.Ping(ctx, nil)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+
+	return map[string]string{
+		"status": "ok",
+	}, nil
 }
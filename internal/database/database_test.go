@@ -0,0 +1,30 @@
+package database
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/config"
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+func TestUpdateStoryMetadataLeavesTrashAlone(t *testing.T) {
+	m := newMemory(nil, config.Default().Database.Timeouts)
+	storyID, err := m.CreateStory(t.Context(), &data.StoryDetails{Title: "Deleted", Genre: "drama", OwnerID: primitive.NewObjectID()})
+	if err != nil {
+		t.Fatalf("CreateStory() error = %v", err)
+	}
+	if _, err := m.DeleteStory(t.Context(), storyID); err != nil {
+		t.Fatalf("DeleteStory() error = %v", err)
+	}
+	before := m.stories[storyID]
+
+	updated, err := m.UpdateStoryMetadata(t.Context(), storyID, data.StoryMetadata{Title: "Renamed", Genre: "comedy", Description: "Changed while in the trash."})
+	if err != nil || updated {
+		t.Errorf("UpdateStoryMetadata() = %v, %v, want false, nil", updated, err)
+	}
+	if after := m.stories[storyID]; after.Title != before.Title || !after.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("trashed story changed to %q, updated at %v", after.Title, after.UpdatedAt)
+	}
+}
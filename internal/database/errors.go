@@ -0,0 +1,44 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The kinds of error a Service reports for callers to act on. Match them
+// with errors.Is; anything else is a failure of the database itself.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrForbidden  = errors.New("forbidden")
+	ErrValidation = errors.New("validation failed")
+)
+
+// Error is an error of one of the kinds above. Its message, unlike those of
+// other errors, is safe to show to clients.
+type Error struct {
+	Kind    error
+	Message string
+	// Details breaks a validation error down by field.
+	Details map[string]string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func notFound(format string, args ...any) error {
+	return &Error{Kind: ErrNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func conflict(format string, args ...any) error {
+	return &Error{Kind: ErrConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+func invalid(details map[string]string, format string, args ...any) error {
+	return &Error{Kind: ErrValidation, Message: fmt.Sprintf(format, args...), Details: details}
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// GetForks lists the listed stories forked directly from id.
+func (s *service) GetForks(ctx context.Context, id primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter := listedFilter()
+	filter["forked_from"] = id
+
+	q := storyPageQuery(filter, page.Sort)
+	coll := s.storyDetails()
+	return findPage(ctx, coll, q, page, storyKey(q.sortField))
+}
+
+// GetAncestors returns the stories id was forked from, its parent first and
+// the original story last. The chain ends early at an ancestor that has been
+// deleted.
+func (s *service) GetAncestors(ctx context.Context, id primitive.ObjectID) ([]data.StoryDetails, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	cursor, err := s.storyDetails().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: notTrashed(primitive.M{"_id": id})}},
+		{{Key: "$graphLookup", Value: primitive.M{
+			"from":                    s.collections.StoryDetails,
+			"startWith":               "$forked_from",
+			"connectFromField":        "forked_from",
+			"connectToField":          "_id",
+			"as":                      "ancestors",
+			"depthField":              "depth",
+			"restrictSearchWithMatch": notTrashed(primitive.M{}),
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching ancestors: %v", err)
+	}
+	type ancestor struct {
+		data.StoryDetails `bson:",inline"`
+		Depth             int `bson:"depth"`
+	}
+	var results []struct {
+		Ancestors []ancestor `bson:"ancestors"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("error decoding ancestors: %v", err)
+	}
+	if len(results) == 0 {
+		return nil, notFound("story not found")
+	}
+
+	found := results[0].Ancestors
+	slices.SortFunc(found, func(a, b ancestor) int {
+		return a.Depth - b.Depth
+	})
+	ancestors := make([]data.StoryDetails, 0, len(found))
+	for _, ancestor := range found {
+		ancestors = append(ancestors, ancestor.StoryDetails)
+	}
+	return ancestors, nil
+}
+
+// GetForkTree returns id with its listed forks, their listed forks and so on,
+// down to depth levels below it. Unlisted forks are left out along with
+// everything forked from them.
+func (s *service) GetForkTree(ctx context.Context, id primitive.ObjectID, depth int) (*data.ForkNode, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	// One level more than is returned is looked up to tell whether the
+	// stories at the depth limit have listed forks of their own.
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: notTrashed(primitive.M{"_id": id})}},
+		{{Key: "$graphLookup", Value: primitive.M{
+			"from":                    s.collections.StoryDetails,
+			"startWith":               "$_id",
+			"connectFromField":        "_id",
+			"connectToField":          "forked_from",
+			"as":                      "descendants",
+			"maxDepth":                depth,
+			"restrictSearchWithMatch": listedFilter(),
+		}}},
+	}
+	cursor, err := s.storyDetails().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching fork tree: %v", err)
+	}
+	var results []struct {
+		data.StoryDetails `bson:",inline"`
+		Descendants       []data.StoryDetails `bson:"descendants"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("error decoding fork tree: %v", err)
+	}
+	if len(results) == 0 {
+		return nil, notFound("story not found")
+	}
+
+	return forkTree(results[0].StoryDetails, results[0].Descendants, depth), nil
+}
+
+// forkTree arranges descendants, which must all descend from root within
+// depth+1 levels, into the tree under root. The last level is only used to
+// mark the stories above it Truncated. Forks of the same story are ordered
+// oldest first.
+func forkTree(root data.StoryDetails, descendants []data.StoryDetails, depth int) *data.ForkNode {
+	children := make(map[primitive.ObjectID][]data.StoryDetails)
+	for _, story := range descendants {
+		children[story.ForkedFrom] = append(children[story.ForkedFrom], story)
+	}
+	for _, forks := range children {
+		slices.SortFunc(forks, func(a, b data.StoryDetails) int {
+			return compareIDs(a.ID, b.ID)
+		})
+	}
+
+	var build func(story data.StoryDetails, level int) data.ForkNode
+	build = func(story data.StoryDetails, level int) data.ForkNode {
+		node := data.ForkNode{Story: story, Forks: []data.ForkNode{}}
+		if level == depth {
+			node.Truncated = len(children[story.ID]) > 0
+			return node
+		}
+		for _, fork := range children[story.ID] {
+			node.Forks = append(node.Forks, build(fork, level+1))
+		}
+		return node
+	}
+	tree := build(root, 0)
+	return &tree
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// createIndexes creates the indexes backing every sortable listing and the
+// lookups the service makes by owner, collaborator and story. Creating an
+// index that already exists is a no-op, so this runs on every startup.
+func (s *service) createIndexes(ctx context.Context) error {
+	if err := s.backfillForkCounts(ctx); err != nil {
+		return err
+	}
+
+	var details []mongo.IndexModel
+	for _, order := range storySorts {
+		direction := 1
+		if order.descending {
+			direction = -1
+		}
+		details = append(details, mongo.IndexModel{
+			Keys: primitive.D{{Key: order.field, Value: direction}, {Key: "_id", Value: direction}},
+		})
+	}
+	details = append(details,
+		mongo.IndexModel{Keys: primitive.D{{Key: "owner_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		mongo.IndexModel{Keys: primitive.D{{Key: "collaborators", Value: 1}}},
+		mongo.IndexModel{Keys: primitive.D{{Key: "invitations", Value: 1}}},
+		mongo.IndexModel{Keys: primitive.D{{Key: "forked_from", Value: 1}, {Key: "owner_id", Value: 1}}},
+		mongo.IndexModel{Keys: primitive.D{{Key: "genre", Value: 1}, {Key: "created_at", Value: -1}}},
+		mongo.IndexModel{Keys: primitive.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	)
+	if _, err := s.storyDetails().Indexes().CreateMany(ctx, details); err != nil {
+		return fmt.Errorf("error creating story details indexes: %v", err)
+	}
+
+	byStory := map[*mongo.Collection]primitive.D{
+		s.storyContent():   {{Key: "story_id", Value: 1}},
+		s.storyRevisions(): {{Key: "story_id", Value: 1}, {Key: "_id", Value: -1}},
+		s.storyChapters():  {{Key: "story_id", Value: 1}, {Key: "order", Value: 1}},
+	}
+	for collection, keys := range byStory {
+		if _, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys}); err != nil {
+			return fmt.Errorf("error creating %s indexes: %v", collection.Name(), err)
+		}
+	}
+
+	merges := []mongo.IndexModel{
+		{Keys: primitive.D{{Key: "story_id", Value: 1}, {Key: "_id", Value: -1}}},
+		// A fork has at most one open merge request.
+		{
+			Keys: primitive.D{{Key: "fork_id", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(primitive.M{"status": data.MergeRequestOpen}),
+		},
+	}
+	if _, err := s.mergeRequests().Indexes().CreateMany(ctx, merges); err != nil {
+		return fmt.Errorf("error creating merge request indexes: %v", err)
+	}
+
+	return s.createTextIndexes(ctx)
+}
+
+// backfillForkCounts sets fork_count on stories saved before it existed so
+// they sort correctly by number of forks. Forks in the trash do not count.
+func (s *service) backfillForkCounts(ctx context.Context) error {
+	details := s.storyDetails()
+
+	missing, err := details.CountDocuments(ctx, primitive.M{"fork_count": primitive.M{"$exists": false}})
+	if err != nil {
+		return fmt.Errorf("error counting stories without fork count: %v", err)
+	}
+	if missing == 0 {
+		return nil
+	}
+
+	cursor, err := details.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: notTrashed(primitive.M{"forked_from": primitive.M{"$exists": true}})}},
+		{{Key: "$group", Value: primitive.M{"_id": "$forked_from", "count": primitive.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return fmt.Errorf("error counting forks: %v", err)
+	}
+	var counts []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int                `bson:"count"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return fmt.Errorf("error decoding fork counts: %v", err)
+	}
+
+	for _, c := range counts {
+		filter := primitive.M{"_id": c.ID, "fork_count": primitive.M{"$exists": false}}
+		if _, err := details.UpdateOne(ctx, filter, primitive.M{"$set": primitive.M{"fork_count": c.Count}}); err != nil {
+			return fmt.Errorf("error backfilling fork count: %v", err)
+		}
+	}
+	if _, err := details.UpdateMany(ctx, primitive.M{"fork_count": primitive.M{"$exists": false}}, primitive.M{"$set": primitive.M{"fork_count": 0}}); err != nil {
+		return fmt.Errorf("error backfilling fork counts: %v", err)
+	}
+
+	return nil
+}
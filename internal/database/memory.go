@@ -0,0 +1,1378 @@
+package database
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/config"
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/search"
+	"github.com/mAmineChniti/StoryHub/internal/users"
+)
+
+// memory is a Service that keeps everything in process memory, for tests and
+// local development without a Mongo cluster. It follows the same rules as the
+// Mongo service, down to the kinds of error it returns. Everything is
+// lost when the process exits.
+type memory struct {
+	mu        sync.RWMutex
+	stories   map[primitive.ObjectID]data.StoryDetails
+	contents  map[primitive.ObjectID]data.StoryContent // keyed by story ID
+	revisions map[primitive.ObjectID]data.StoryRevision
+	chapters  map[primitive.ObjectID]data.Chapter
+	merges    map[primitive.ObjectID]data.MergeRequest
+
+	// directory tells orphan cleanup which story owners still exist.
+	directory users.Directory
+	timeouts  config.Timeouts
+	cleanups  cleanupRuns
+}
+
+// NewMemory returns an empty in-memory Service. It also implements
+// search.Engine, which NewSearchEngine picks up. directory may be nil when
+// orphan cleanup is not needed.
+func NewMemory(directory users.Directory) Service {
+	return newMemory(directory, config.Default().Database.Timeouts)
+}
+
+func newMemory(directory users.Directory, timeouts config.Timeouts) *memory {
+	return &memory{
+		stories:   make(map[primitive.ObjectID]data.StoryDetails),
+		contents:  make(map[primitive.ObjectID]data.StoryContent),
+		revisions: make(map[primitive.ObjectID]data.StoryRevision),
+		chapters:  make(map[primitive.ObjectID]data.Chapter),
+		merges:    make(map[primitive.ObjectID]data.MergeRequest),
+		directory: directory,
+		timeouts:  timeouts,
+	}
+}
+
+// storedTime rounds t the way a BSON date does, so timestamps and the
+// cursors built from them compare the same as they would in Mongo.
+func storedTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
+
+// cloneStory copies a story deeply enough that callers cannot modify the
+// stored one through its slices, map or pointers.
+func cloneStory(story data.StoryDetails) data.StoryDetails {
+	story.Collaborators = slices.Clone(story.Collaborators)
+	story.Invitations = slices.Clone(story.Invitations)
+	story.Roles = maps.Clone(story.Roles)
+	if story.PublishedAt != nil {
+		publishedAt := *story.PublishedAt
+		story.PublishedAt = &publishedAt
+	}
+	if story.ScheduledAt != nil {
+		scheduledAt := *story.ScheduledAt
+		story.ScheduledAt = &scheduledAt
+	}
+	if story.DeletedAt != nil {
+		deletedAt := *story.DeletedAt
+		story.DeletedAt = &deletedAt
+	}
+	return story
+}
+
+func (m *memory) CreateStory(ctx context.Context, req *data.StoryDetails) (primitive.ObjectID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.createStory(req)
+}
+
+func (m *memory) createStory(req *data.StoryDetails) (primitive.ObjectID, error) {
+	now := storedTime(time.Now())
+	req.CreatedAt = now
+	req.UpdatedAt = now
+	if req.Visibility == "" {
+		req.Visibility = data.VisibilityPublic
+	}
+	if req.Status == "" {
+		req.Status = data.StatusPublished
+	}
+	if req.Status == data.StatusPublished && req.PublishedAt == nil {
+		req.PublishedAt = &req.CreatedAt
+	}
+
+	story := cloneStory(*req)
+	if story.ID.IsZero() {
+		story.ID = primitive.NewObjectID()
+	}
+	if _, ok := m.stories[story.ID]; ok {
+		return primitive.NilObjectID, fmt.Errorf("error inserting story: duplicate key %s", story.ID.Hex())
+	}
+	m.stories[story.ID] = story
+
+	return story.ID, nil
+}
+
+func (m *memory) GetStoryDetails(ctx context.Context, id primitive.ObjectID) (*data.StoryDetails, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	story, ok := m.stories[id]
+	if !ok || story.Trashed() {
+		return nil, notFound("story not found")
+	}
+	story = cloneStory(story)
+	return &story, nil
+}
+
+func (m *memory) GetStoryContent(ctx context.Context, id primitive.ObjectID) (*data.StoryContent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if story, ok := m.stories[id]; !ok || story.Trashed() {
+		return nil, notFound("story not found")
+	}
+	content, ok := m.contents[id]
+	if !ok {
+		return &data.StoryContent{StoryID: id}, nil
+	}
+	return &content, nil
+}
+
+// storyPage returns one page of the stories matching match, in the order
+// page asks for.
+func (m *memory) storyPage(match func(*data.StoryDetails) bool, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	m.mu.RLock()
+	var stories []data.StoryDetails
+	for _, story := range m.stories {
+		if match(&story) {
+			stories = append(stories, cloneStory(story))
+		}
+	}
+	m.mu.RUnlock()
+
+	q := storyPageQuery(nil, page.Sort)
+	return slicePage(stories, q, page, storyKey(q.sortField))
+}
+
+func (m *memory) GetStories(ctx context.Context, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	return m.storyPage(search.Listed, page)
+}
+
+func (m *memory) GetStoryCollaborators(ctx context.Context, id primitive.ObjectID) ([]primitive.ObjectID, error) {
+	story, err := m.GetStoryDetails(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return story.Collaborators, nil
+}
+
+func (m *memory) GetStoriesByFilters(ctx context.Context, genres []string, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	return m.storyPage(func(story *data.StoryDetails) bool {
+		return search.Listed(story) && (len(genres) == 0 || slices.Contains(genres, story.Genre))
+	}, page)
+}
+
+func (m *memory) GetStoriesByUser(ctx context.Context, userID primitive.ObjectID, includeUnlisted bool, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	return m.storyPage(func(story *data.StoryDetails) bool {
+		return story.OwnerID == userID && !story.Trashed() && (includeUnlisted || search.Listed(story))
+	}, page)
+}
+
+func (m *memory) GetCollaborations(ctx context.Context, userID primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	return m.storyPage(func(story *data.StoryDetails) bool {
+		return slices.Contains(story.Collaborators, userID) && !story.Trashed()
+	}, page)
+}
+
+func (m *memory) GetInvitations(ctx context.Context, userID primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	return m.storyPage(func(story *data.StoryDetails) bool {
+		return slices.Contains(story.Invitations, userID) && !story.Trashed()
+	}, page)
+}
+
+// updateStory applies fn to a stored story and saves the result. It reports
+// false, without calling fn, when the story does not exist, and also when fn
+// itself reports false, in which case nothing is saved.
+func (m *memory) updateStory(id primitive.ObjectID, fn func(story *data.StoryDetails) bool) bool {
+	story, ok := m.stories[id]
+	if !ok {
+		return false
+	}
+	story = cloneStory(story)
+	if !fn(&story) {
+		return false
+	}
+	m.stories[id] = story
+	return true
+}
+
+func (m *memory) touch(id primitive.ObjectID) {
+	m.updateStory(id, func(story *data.StoryDetails) bool {
+		story.UpdatedAt = storedTime(time.Now())
+		return true
+	})
+}
+
+func (m *memory) InviteCollaborator(ctx context.Context, id, userID primitive.ObjectID, role data.Role) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateStory(id, func(story *data.StoryDetails) bool {
+		if story.OwnerID == userID || slices.Contains(story.Collaborators, userID) || slices.Contains(story.Invitations, userID) {
+			return false
+		}
+		story.Invitations = append(story.Invitations, userID)
+		if story.Roles == nil {
+			story.Roles = make(map[string]data.Role)
+		}
+		story.Roles[userID.Hex()] = role
+		return true
+	}), nil
+}
+
+func (m *memory) RespondToInvitation(ctx context.Context, id, userID primitive.ObjectID, accept bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateStory(id, func(story *data.StoryDetails) bool {
+		if story.Trashed() || !slices.Contains(story.Invitations, userID) {
+			return false
+		}
+		story.Invitations = removeID(story.Invitations, userID)
+		if accept {
+			if !slices.Contains(story.Collaborators, userID) {
+				story.Collaborators = append(story.Collaborators, userID)
+			}
+			story.UpdatedAt = storedTime(time.Now())
+		} else {
+			delete(story.Roles, userID.Hex())
+		}
+		return true
+	}), nil
+}
+
+func (m *memory) RemoveCollaborator(ctx context.Context, id, userID primitive.ObjectID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateStory(id, func(story *data.StoryDetails) bool {
+		if !slices.Contains(story.Collaborators, userID) && !slices.Contains(story.Invitations, userID) {
+			return false
+		}
+		story.Collaborators = removeID(story.Collaborators, userID)
+		story.Invitations = removeID(story.Invitations, userID)
+		delete(story.Roles, userID.Hex())
+		story.UpdatedAt = storedTime(time.Now())
+		return true
+	}), nil
+}
+
+func (m *memory) SetCollaboratorRole(ctx context.Context, id, userID primitive.ObjectID, role data.Role) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateStory(id, func(story *data.StoryDetails) bool {
+		if !slices.Contains(story.Collaborators, userID) {
+			return false
+		}
+		if story.Roles == nil {
+			story.Roles = make(map[string]data.Role)
+		}
+		story.Roles[userID.Hex()] = role
+		story.UpdatedAt = storedTime(time.Now())
+		return true
+	}), nil
+}
+
+func (m *memory) TransferOwnership(ctx context.Context, id, newOwnerID primitive.ObjectID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.stories[id]; !ok {
+		return false, notFound("story not found")
+	}
+
+	return m.updateStory(id, func(story *data.StoryDetails) bool {
+		if !slices.Contains(story.Collaborators, newOwnerID) {
+			return false
+		}
+		previousOwnerID := story.OwnerID
+		story.OwnerID = newOwnerID
+		story.Collaborators = append(removeID(story.Collaborators, newOwnerID), previousOwnerID)
+		if story.Roles == nil {
+			story.Roles = make(map[string]data.Role)
+		}
+		story.Roles[previousOwnerID.Hex()] = data.RoleEditor
+		delete(story.Roles, newOwnerID.Hex())
+		story.UpdatedAt = storedTime(time.Now())
+		return true
+	}), nil
+}
+
+func removeID(ids []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	return slices.DeleteFunc(ids, func(other primitive.ObjectID) bool { return other == id })
+}
+
+func (m *memory) insertRevision(storyID, authorID primitive.ObjectID, content string, restoredFrom primitive.ObjectID) primitive.ObjectID {
+	revision := data.StoryRevision{
+		ID:           primitive.NewObjectID(),
+		StoryID:      storyID,
+		AuthorID:     authorID,
+		Content:      content,
+		Size:         len(content),
+		RestoredFrom: restoredFrom,
+		CreatedAt:    storedTime(time.Now()),
+	}
+	m.revisions[revision.ID] = revision
+	return revision.ID
+}
+
+// baselineRevision is the in-memory counterpart of service.baselineRevision.
+func (m *memory) baselineRevision(storyID primitive.ObjectID) {
+	head, ok := m.contents[storyID]
+	if !ok || head.Content == "" {
+		return
+	}
+	if !head.RevisionID.IsZero() {
+		for _, revision := range m.revisions {
+			if revision.StoryID == storyID {
+				return
+			}
+		}
+	}
+	revisionID := m.insertRevision(storyID, m.stories[storyID].OwnerID, head.Content, primitive.NilObjectID)
+	m.setContentHead(storyID, revisionID, head.Content)
+}
+
+func (m *memory) setContentHead(storyID, revisionID primitive.ObjectID, content string) {
+	head, ok := m.contents[storyID]
+	if !ok {
+		head = data.StoryContent{ID: primitive.NewObjectID(), StoryID: storyID}
+	}
+	head.Content = content
+	head.RevisionID = revisionID
+	m.contents[storyID] = head
+}
+
+func (m *memory) EditStoryContent(ctx context.Context, id, authorID primitive.ObjectID, content string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.editStoryContent(id, authorID, content); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *memory) editStoryContent(id, authorID primitive.ObjectID, content string) (primitive.ObjectID, error) {
+	if _, ok := m.stories[id]; !ok {
+		return primitive.NilObjectID, notFound("story not found")
+	}
+
+	m.baselineRevision(id)
+	revisionID := m.insertRevision(id, authorID, content, primitive.NilObjectID)
+	m.setContentHead(id, revisionID, content)
+	m.touch(id)
+
+	return revisionID, nil
+}
+
+func (m *memory) GetStoryRevisions(ctx context.Context, id primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryRevision], error) {
+	m.mu.RLock()
+	var revisions []data.StoryRevision
+	for _, revision := range m.revisions {
+		if revision.StoryID == id {
+			revision.Content = ""
+			revisions = append(revisions, revision)
+		}
+	}
+	m.mu.RUnlock()
+
+	q := pageQuery{descending: true}
+	return slicePage(revisions, q, page, func(r *data.StoryRevision) (primitive.ObjectID, any) { return r.ID, nil })
+}
+
+func (m *memory) GetStoryRevision(ctx context.Context, id, revisionID primitive.ObjectID) (*data.StoryRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revision, ok := m.revisions[revisionID]
+	if !ok || revision.StoryID != id {
+		return nil, notFound("revision not found")
+	}
+	return &revision, nil
+}
+
+func (m *memory) RestoreStoryRevision(ctx context.Context, id, revisionID, userID primitive.ObjectID) (primitive.ObjectID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	revision, ok := m.revisions[revisionID]
+	if !ok || revision.StoryID != id {
+		return primitive.NilObjectID, notFound("revision not found")
+	}
+
+	m.baselineRevision(id)
+	newRevisionID := m.insertRevision(id, userID, revision.Content, revision.ID)
+	m.setContentHead(id, newRevisionID, revision.Content)
+	m.touch(id)
+
+	return newRevisionID, nil
+}
+
+// cloneMergeRequest copies a merge request so callers cannot modify the
+// stored one through its comments or decision time.
+func cloneMergeRequest(request data.MergeRequest) data.MergeRequest {
+	request.Comments = slices.Clone(request.Comments)
+	if request.DecidedAt != nil {
+		decidedAt := *request.DecidedAt
+		request.DecidedAt = &decidedAt
+	}
+	return request
+}
+
+func (m *memory) CreateMergeRequest(ctx context.Context, req *data.MergeRequest) (primitive.ObjectID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, other := range m.merges {
+		if other.ForkID == req.ForkID && other.Status == data.MergeRequestOpen {
+			return primitive.NilObjectID, conflict("this fork already has an open merge request")
+		}
+	}
+
+	now := storedTime(time.Now())
+	request := cloneMergeRequest(*req)
+	request.ID = primitive.NewObjectID()
+	request.Status = data.MergeRequestOpen
+	request.Comments = []data.MergeComment{}
+	request.CreatedAt = now
+	request.UpdatedAt = now
+	m.merges[request.ID] = request
+
+	return request.ID, nil
+}
+
+func (m *memory) GetMergeRequest(ctx context.Context, id primitive.ObjectID) (*data.MergeRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	request, ok := m.merges[id]
+	if !ok {
+		return nil, notFound("merge request not found")
+	}
+	request = cloneMergeRequest(request)
+	return &request, nil
+}
+
+func (m *memory) GetMergeRequests(ctx context.Context, storyID primitive.ObjectID, status data.MergeRequestStatus, page data.PageRequest) (*data.Page[data.MergeRequest], error) {
+	m.mu.RLock()
+	var requests []data.MergeRequest
+	for _, request := range m.merges {
+		if request.StoryID == storyID && (status == "" || request.Status == status) {
+			request = cloneMergeRequest(request)
+			request.Content = ""
+			request.Comments = nil
+			requests = append(requests, request)
+		}
+	}
+	m.mu.RUnlock()
+
+	q := pageQuery{descending: true}
+	return slicePage(requests, q, page, func(r *data.MergeRequest) (primitive.ObjectID, any) { return r.ID, nil })
+}
+
+func (m *memory) AddMergeComment(ctx context.Context, id, authorID primitive.ObjectID, body string) (primitive.ObjectID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, ok := m.merges[id]
+	if !ok {
+		return primitive.NilObjectID, notFound("merge request not found")
+	}
+
+	now := storedTime(time.Now())
+	comment := data.MergeComment{
+		ID:        primitive.NewObjectID(),
+		AuthorID:  authorID,
+		Body:      body,
+		CreatedAt: now,
+	}
+	request.Comments = append(slices.Clone(request.Comments), comment)
+	request.UpdatedAt = now
+	m.merges[id] = request
+
+	return comment.ID, nil
+}
+
+func (m *memory) AcceptMergeRequest(ctx context.Context, id, reviewerID primitive.ObjectID) (primitive.ObjectID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, err := m.decideMergeRequest(id, reviewerID, data.MergeRequestAccepted)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	revisionID, err := m.editStoryContent(request.StoryID, request.AuthorID, request.Content)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	request.RevisionID = revisionID
+	m.merges[id] = request
+	return revisionID, nil
+}
+
+func (m *memory) RejectMergeRequest(ctx context.Context, id, reviewerID primitive.ObjectID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, err := m.decideMergeRequest(id, reviewerID, data.MergeRequestRejected)
+	if err != nil {
+		return false, err
+	}
+	m.merges[id] = request
+	return true, nil
+}
+
+// decideMergeRequest returns an open merge request moved to status, for the
+// caller to store once the rest of the decision has succeeded.
+func (m *memory) decideMergeRequest(id, reviewerID primitive.ObjectID, status data.MergeRequestStatus) (data.MergeRequest, error) {
+	request, ok := m.merges[id]
+	if !ok {
+		return data.MergeRequest{}, notFound("merge request not found")
+	}
+	if request.Status != data.MergeRequestOpen {
+		return data.MergeRequest{}, conflict("merge request has already been decided")
+	}
+
+	now := storedTime(time.Now())
+	request = cloneMergeRequest(request)
+	request.Status = status
+	request.DecidedBy = reviewerID
+	request.DecidedAt = &now
+	request.UpdatedAt = now
+	return request, nil
+}
+
+func (m *memory) SetStoryVisibility(ctx context.Context, id primitive.ObjectID, visibility data.Visibility) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateStory(id, func(story *data.StoryDetails) bool {
+		story.Visibility = visibility
+		story.UpdatedAt = storedTime(time.Now())
+		return true
+	}), nil
+}
+
+func (m *memory) UpdateStoryMetadata(ctx context.Context, id primitive.ObjectID, metadata data.StoryMetadata) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateStory(id, func(story *data.StoryDetails) bool {
+		if story.Trashed() {
+			return false
+		}
+		story.Title = metadata.Title
+		story.Genre = metadata.Genre
+		story.Description = metadata.Description
+		story.UpdatedAt = storedTime(time.Now())
+		return true
+	}), nil
+}
+
+func (m *memory) PublishStory(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateStory(id, func(story *data.StoryDetails) bool {
+		now := storedTime(time.Now())
+		story.Status = data.StatusPublished
+		if story.PublishedAt == nil {
+			story.PublishedAt = &now
+		}
+		story.ScheduledAt = nil
+		story.UpdatedAt = now
+		return true
+	}), nil
+}
+
+func (m *memory) ScheduleStory(ctx context.Context, id primitive.ObjectID, publishAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateStory(id, func(story *data.StoryDetails) bool {
+		scheduledAt := storedTime(publishAt)
+		story.Status = data.StatusDraft
+		story.ScheduledAt = &scheduledAt
+		story.UpdatedAt = storedTime(time.Now())
+		return true
+	}), nil
+}
+
+func (m *memory) UnpublishStory(ctx context.Context, id primitive.ObjectID, status data.PublicationStatus) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateStory(id, func(story *data.StoryDetails) bool {
+		story.Status = status
+		story.ScheduledAt = nil
+		story.UpdatedAt = storedTime(time.Now())
+		return true
+	}), nil
+}
+
+func (m *memory) PublishScheduledStories(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := storedTime(time.Now())
+	var published int64
+	for id, story := range m.stories {
+		if story.Trashed() || story.Status != data.StatusDraft || story.ScheduledAt == nil || story.ScheduledAt.After(now) {
+			continue
+		}
+		m.updateStory(id, func(story *data.StoryDetails) bool {
+			story.Status = data.StatusPublished
+			story.PublishedAt = story.ScheduledAt
+			story.ScheduledAt = nil
+			story.UpdatedAt = now
+			return true
+		})
+		published++
+	}
+
+	return published, nil
+}
+
+// storyChapters returns the chapters of a story in reading order.
+func (m *memory) storyChapters(storyID primitive.ObjectID) []data.Chapter {
+	var chapters []data.Chapter
+	for _, chapter := range m.chapters {
+		if chapter.StoryID == storyID {
+			chapters = append(chapters, chapter)
+		}
+	}
+	slices.SortFunc(chapters, func(a, b data.Chapter) int {
+		return cmp.Or(cmp.Compare(a.Order, b.Order), compareIDs(a.ID, b.ID))
+	})
+	return chapters
+}
+
+func (m *memory) insertChapter(chapter data.Chapter) primitive.ObjectID {
+	chapter.ID = primitive.NewObjectID()
+	chapter.CreatedAt = storedTime(chapter.CreatedAt)
+	chapter.UpdatedAt = storedTime(chapter.UpdatedAt)
+	m.chapters[chapter.ID] = chapter
+	return chapter.ID
+}
+
+func (m *memory) CreateChapter(ctx context.Context, id, authorID primitive.ObjectID, title, content string) (primitive.ObjectID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing := m.storyChapters(id)
+	order := 0
+	if len(existing) == 0 {
+		if head, ok := m.contents[id]; ok && head.Content != "" {
+			m.insertChapter(newChapter(id, "Chapter 1", 0, head.Content))
+			order = 1
+		}
+	} else {
+		for _, chapter := range existing {
+			order = max(order, chapter.Order+1)
+		}
+	}
+
+	chapterID := m.insertChapter(newChapter(id, title, order, content))
+	m.syncChapterContent(id, authorID)
+
+	return chapterID, nil
+}
+
+func (m *memory) GetChapters(ctx context.Context, id primitive.ObjectID) ([]data.Chapter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chapters := m.storyChapters(id)
+	for i := range chapters {
+		chapters[i].Content = ""
+	}
+	return chapters, nil
+}
+
+func (m *memory) GetChapter(ctx context.Context, id, chapterID primitive.ObjectID) (*data.Chapter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chapter, ok := m.chapters[chapterID]
+	if !ok || chapter.StoryID != id {
+		return nil, notFound("chapter not found")
+	}
+	return &chapter, nil
+}
+
+func (m *memory) CountChapters(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return int64(len(m.storyChapters(id))), nil
+}
+
+func (m *memory) EditChapter(ctx context.Context, id, chapterID, authorID primitive.ObjectID, title, content *string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chapter, ok := m.chapters[chapterID]
+	if !ok || chapter.StoryID != id {
+		return false, nil
+	}
+	if title != nil {
+		chapter.Title = *title
+	}
+	if content != nil {
+		chapter.Content = *content
+	}
+	chapter.UpdatedAt = storedTime(time.Now())
+	m.chapters[chapterID] = chapter
+
+	m.syncChapterContent(id, authorID)
+	return true, nil
+}
+
+func (m *memory) DeleteChapter(ctx context.Context, id, chapterID, authorID primitive.ObjectID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chapter, ok := m.chapters[chapterID]
+	if !ok || chapter.StoryID != id {
+		return false, nil
+	}
+	delete(m.chapters, chapterID)
+
+	m.syncChapterContent(id, authorID)
+	return true, nil
+}
+
+func (m *memory) ReorderChapters(ctx context.Context, id, authorID primitive.ObjectID, chapterIDs []primitive.ObjectID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing := m.storyChapters(id)
+	if len(existing) != len(chapterIDs) {
+		return false, nil
+	}
+	known := make(map[primitive.ObjectID]bool, len(existing))
+	for _, chapter := range existing {
+		known[chapter.ID] = true
+	}
+	for _, chapterID := range chapterIDs {
+		if !known[chapterID] {
+			return false, nil
+		}
+		delete(known, chapterID)
+	}
+
+	for i, chapterID := range chapterIDs {
+		chapter := m.chapters[chapterID]
+		chapter.Order = i
+		m.chapters[chapterID] = chapter
+	}
+
+	m.syncChapterContent(id, authorID)
+	return true, nil
+}
+
+// syncChapterContent rebuilds the story's content from its chapters and
+// records it as a new revision authored by authorID.
+func (m *memory) syncChapterContent(storyID, authorID primitive.ObjectID) {
+	content := joinChapters(m.storyChapters(storyID))
+	m.baselineRevision(storyID)
+	revisionID := m.insertRevision(storyID, authorID, content, primitive.NilObjectID)
+	m.setContentHead(storyID, revisionID, content)
+	m.touch(storyID)
+}
+
+func (m *memory) ForkStory(ctx context.Context, id, userID primitive.ObjectID) (primitive.ObjectID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	story, ok := m.stories[id]
+	if !ok || story.Trashed() {
+		return primitive.NilObjectID, notFound("story not found")
+	}
+
+	for _, existing := range m.stories {
+		if existing.ForkedFrom == id && existing.OwnerID == userID && !existing.Trashed() {
+			return primitive.NilObjectID, conflict("you have already forked this story")
+		}
+	}
+
+	forkedStory := &data.StoryDetails{
+		OwnerID:       userID,
+		Title:         story.Title,
+		Description:   story.Description,
+		Genre:         story.Genre,
+		Collaborators: []primitive.ObjectID{},
+		Visibility:    story.EffectiveVisibility(),
+		Status:        data.StatusPublished,
+		ForkedFrom:    story.ID,
+	}
+	// Forking a draft must not publish it behind the owner's back.
+	if story.EffectiveStatus() == data.StatusDraft {
+		forkedStory.Status = data.StatusDraft
+	}
+	m.baselineRevision(id)
+	if head, ok := m.contents[id]; ok && head.Content != "" {
+		forkedStory.ForkRevision = head.RevisionID
+	}
+
+	forkID, err := m.createStory(forkedStory)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error creating forked story: %v", err)
+	}
+
+	m.updateStory(id, func(story *data.StoryDetails) bool {
+		story.ForkCount++
+		return true
+	})
+
+	if head, ok := m.contents[id]; ok && head.Content != "" {
+		revisionID := m.insertRevision(forkID, userID, head.Content, primitive.NilObjectID)
+		m.setContentHead(forkID, revisionID, head.Content)
+	}
+
+	for _, chapter := range m.storyChapters(id) {
+		m.insertChapter(newChapter(forkID, chapter.Title, chapter.Order, chapter.Content))
+	}
+
+	return forkID, nil
+}
+
+func (m *memory) GetForks(ctx context.Context, id primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	return m.storyPage(func(story *data.StoryDetails) bool {
+		return story.ForkedFrom == id && search.Listed(story)
+	}, page)
+}
+
+func (m *memory) GetAncestors(ctx context.Context, id primitive.ObjectID) ([]data.StoryDetails, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	story, ok := m.stories[id]
+	if !ok || story.Trashed() {
+		return nil, notFound("story not found")
+	}
+	ancestors := []data.StoryDetails{}
+	for parentID := story.ForkedFrom; !parentID.IsZero(); {
+		parent, ok := m.stories[parentID]
+		// Forks only ever point at older stories, so the chain cannot loop
+		// unless the store was filled in by hand.
+		if !ok || parent.Trashed() || len(ancestors) == len(m.stories) {
+			break
+		}
+		ancestors = append(ancestors, cloneStory(parent))
+		parentID = parent.ForkedFrom
+	}
+	return ancestors, nil
+}
+
+func (m *memory) GetForkTree(ctx context.Context, id primitive.ObjectID, depth int) (*data.ForkNode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	root, ok := m.stories[id]
+	if !ok || root.Trashed() {
+		return nil, notFound("story not found")
+	}
+	var descendants []data.StoryDetails
+	level := []primitive.ObjectID{id}
+	for range depth + 1 {
+		var next []primitive.ObjectID
+		for _, story := range m.stories {
+			if slices.Contains(level, story.ForkedFrom) && search.Listed(&story) {
+				descendants = append(descendants, cloneStory(story))
+				next = append(next, story.ID)
+			}
+		}
+		level = next
+	}
+	return forkTree(cloneStory(root), descendants, depth), nil
+}
+
+// deleteStories removes stories along with their content, revisions,
+// chapters and merge requests, and releases the forks they held on their parents if they were
+// not already in the trash.
+func (m *memory) deleteStories(ids []primitive.ObjectID) {
+	deleted := make(map[primitive.ObjectID]bool, len(ids))
+	var parents []primitive.ObjectID
+	for _, id := range ids {
+		story, ok := m.stories[id]
+		if !ok {
+			continue
+		}
+		delete(m.stories, id)
+		delete(m.contents, id)
+		deleted[id] = true
+		if !story.ForkedFrom.IsZero() && !story.Trashed() {
+			parents = append(parents, story.ForkedFrom)
+		}
+	}
+	m.addForks(parents, -1)
+
+	maps.DeleteFunc(m.revisions, func(_ primitive.ObjectID, revision data.StoryRevision) bool {
+		return deleted[revision.StoryID]
+	})
+	maps.DeleteFunc(m.chapters, func(_ primitive.ObjectID, chapter data.Chapter) bool {
+		return deleted[chapter.StoryID]
+	})
+	maps.DeleteFunc(m.merges, func(_ primitive.ObjectID, request data.MergeRequest) bool {
+		return deleted[request.StoryID] || deleted[request.ForkID]
+	})
+}
+
+// ownedBy returns the IDs of the stories owned by any of ownerIDs.
+func (m *memory) ownedBy(ownerIDs ...primitive.ObjectID) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for id, story := range m.stories {
+		if slices.Contains(ownerIDs, story.OwnerID) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// addForks adds delta to the fork count of each of parents, once per
+// appearance.
+func (m *memory) addForks(parents []primitive.ObjectID, delta int) {
+	for _, parentID := range parents {
+		m.updateStory(parentID, func(story *data.StoryDetails) bool {
+			story.ForkCount += delta
+			return true
+		})
+	}
+}
+
+// trashStories moves stories to the trash and releases the forks they held
+// on their parents.
+func (m *memory) trashStories(ids []primitive.ObjectID) {
+	now := storedTime(time.Now())
+	var parents []primitive.ObjectID
+	for _, id := range ids {
+		m.updateStory(id, func(story *data.StoryDetails) bool {
+			if story.Trashed() {
+				return false
+			}
+			story.DeletedAt = &now
+			if !story.ForkedFrom.IsZero() {
+				parents = append(parents, story.ForkedFrom)
+			}
+			return true
+		})
+	}
+	m.addForks(parents, -1)
+}
+
+func (m *memory) DeleteStory(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if story, ok := m.stories[id]; !ok || story.Trashed() {
+		return false, notFound("story not found")
+	}
+	m.trashStories([]primitive.ObjectID{id})
+
+	return true, nil
+}
+
+func (m *memory) DeleteAllStoriesByUser(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.trashStories(m.ownedBy(userID))
+	return true, nil
+}
+
+// restorable reports whether story was trashed within retention.
+func restorable(story *data.StoryDetails, retention time.Duration) bool {
+	return story.Trashed() && !story.DeletedAt.Before(time.Now().Add(-retention))
+}
+
+func (m *memory) GetTrash(ctx context.Context, userID primitive.ObjectID, retention time.Duration, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	return m.storyPage(func(story *data.StoryDetails) bool {
+		return story.OwnerID == userID && restorable(story, retention)
+	}, page)
+}
+
+func (m *memory) GetTrashedStory(ctx context.Context, id primitive.ObjectID, retention time.Duration) (*data.StoryDetails, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	story, ok := m.stories[id]
+	if !ok || !restorable(&story, retention) {
+		return nil, notFound("story not found in trash")
+	}
+	story = cloneStory(story)
+	return &story, nil
+}
+
+func (m *memory) RestoreStory(ctx context.Context, id primitive.ObjectID, retention time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	story, ok := m.stories[id]
+	if !ok || !restorable(&story, retention) {
+		return false, notFound("story not found in trash")
+	}
+	if !story.ForkedFrom.IsZero() {
+		for _, other := range m.stories {
+			if other.ForkedFrom == story.ForkedFrom && other.OwnerID == story.OwnerID && !other.Trashed() {
+				return false, conflict("you have forked this story again since deleting this fork")
+			}
+		}
+	}
+
+	m.updateStory(id, func(story *data.StoryDetails) bool {
+		story.DeletedAt = nil
+		story.UpdatedAt = storedTime(time.Now())
+		return true
+	})
+	if !story.ForkedFrom.IsZero() {
+		m.addForks([]primitive.ObjectID{story.ForkedFrom}, 1)
+	}
+
+	return true, nil
+}
+
+func (m *memory) PurgeTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired []primitive.ObjectID
+	for id, story := range m.stories {
+		if story.Trashed() && !restorable(&story, retention) {
+			expired = append(expired, id)
+		}
+	}
+	m.deleteStories(expired)
+
+	return int64(len(expired)), nil
+}
+
+func (m *memory) Health(ctx context.Context) (map[string]string, error) {
+	return map[string]string{
+		"status": "ok",
+	}, nil
+}
+
+func (m *memory) CleanupOrphanedStories(ctx context.Context, opts CleanupOptions) (*CleanupReport, error) {
+	return m.cleanups.run(opts, func(report *CleanupReport) error {
+		ctx, cancel := context.WithTimeout(ctx, m.timeouts.Background)
+		defer cancel()
+		return m.cleanupOrphanedStories(ctx, opts, report)
+	})
+}
+
+func (m *memory) LastCleanupReport() *CleanupReport {
+	return m.cleanups.lastReport()
+}
+
+func (m *memory) cleanupOrphanedStories(ctx context.Context, opts CleanupOptions, report *CleanupReport) error {
+	m.mu.RLock()
+	var ownerIDs []primitive.ObjectID
+	for _, story := range m.stories {
+		if !slices.Contains(ownerIDs, story.OwnerID) {
+			ownerIDs = append(ownerIDs, story.OwnerID)
+		}
+	}
+	m.mu.RUnlock()
+	report.OwnersChecked = len(ownerIDs)
+
+	// The directory is asked without holding the lock; it can be slow.
+	orphanedOwnerIDs, err := orphanedOwners(ctx, m.directory, ownerIDs)
+	if err != nil {
+		return err
+	}
+	if len(orphanedOwnerIDs) == 0 {
+		return nil
+	}
+	report.OrphanedOwners = orphanedOwnerIDs
+	if opts.abort(report) {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	orphanedStories := m.ownedBy(orphanedOwnerIDs...)
+	report.Stories = append(report.Stories, orphanedStories...)
+	slices.SortFunc(report.Stories, compareIDs)
+
+	var collaborated []data.StoryDetails
+	for _, story := range m.stories {
+		if !slices.Contains(orphanedOwnerIDs, story.OwnerID) {
+			collaborated = append(collaborated, story)
+		}
+	}
+	if removals := collaboratorRemovals(collaborated, orphanedOwnerIDs); removals != nil {
+		report.CollaboratorRemovals = removals
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	m.deleteStories(orphanedStories)
+
+	for _, removal := range report.CollaboratorRemovals {
+		m.updateStory(removal.StoryID, func(story *data.StoryDetails) bool {
+			story.Collaborators = removeID(story.Collaborators, removal.UserID)
+			story.Invitations = removeID(story.Invitations, removal.UserID)
+			delete(story.Roles, removal.UserID.Hex())
+			return true
+		})
+	}
+
+	return nil
+}
+
+// CheckConsistency runs the same checks as the Mongo service. Every write
+// here happens under one lock, so it only finds problems in a store that was
+// filled in by hand.
+func (m *memory) CheckConsistency(ctx context.Context, repair bool) (*ConsistencyReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := &consistencySnapshot{
+		forkCounts:  make(map[primitive.ObjectID]int),
+		forks:       make(map[primitive.ObjectID]int),
+		forkedFrom:  make(map[primitive.ObjectID]primitive.ObjectID),
+		copiedForks: make(map[primitive.ObjectID]bool),
+		content:     make(map[primitive.ObjectID]bool),
+		revisions:   make(map[primitive.ObjectID]int),
+		chapters:    make(map[primitive.ObjectID]bool),
+		splitForks:  make(map[primitive.ObjectID]bool),
+	}
+	for id, story := range m.stories {
+		snapshot.forkCounts[id] = story.ForkCount
+		if story.ForkedFrom.IsZero() {
+			continue
+		}
+		snapshot.forkedFrom[id] = story.ForkedFrom
+		snapshot.copiedForks[id] = !story.ForkRevision.IsZero()
+		if !story.Trashed() {
+			snapshot.forks[story.ForkedFrom]++
+		}
+	}
+	for storyID := range m.contents {
+		snapshot.content[storyID] = true
+	}
+	for _, revision := range m.revisions {
+		snapshot.revisions[revision.StoryID]++
+	}
+	for _, chapter := range m.chapters {
+		snapshot.chapters[chapter.StoryID] = true
+	}
+	for forkID := range snapshot.forkedFrom {
+		if snapshot.chapters[forkID] {
+			snapshot.splitForks[forkID] = joinChapters(m.storyChapters(forkID)) != m.contents[forkID].Content
+		}
+	}
+	for id, request := range m.merges {
+		if request.Status == data.MergeRequestAccepted && request.RevisionID.IsZero() {
+			snapshot.unappliedMerges = append(snapshot.unappliedMerges, id)
+		}
+	}
+
+	report := snapshot.report()
+	if !repair || report.Consistent() {
+		return report, nil
+	}
+
+	for _, storyID := range report.OrphanedStories {
+		delete(m.contents, storyID)
+	}
+	maps.DeleteFunc(m.revisions, func(_ primitive.ObjectID, revision data.StoryRevision) bool {
+		return slices.Contains(report.OrphanedStories, revision.StoryID)
+	})
+	maps.DeleteFunc(m.chapters, func(_ primitive.ObjectID, chapter data.Chapter) bool {
+		return slices.Contains(report.OrphanedStories, chapter.StoryID)
+	})
+
+	for _, storyID := range report.MissingContent {
+		var latest data.StoryRevision
+		for _, revision := range m.revisions {
+			if revision.StoryID == storyID && compareIDs(revision.ID, latest.ID) > 0 {
+				latest = revision
+			}
+		}
+		m.setContentHead(storyID, latest.ID, latest.Content)
+	}
+
+	for _, forkID := range report.IncompleteForks {
+		m.recopyFork(forkID)
+	}
+
+	for _, drift := range report.ForkCounts {
+		m.updateStory(drift.StoryID, func(story *data.StoryDetails) bool {
+			story.ForkCount = drift.Actual
+			return true
+		})
+	}
+
+	for _, id := range report.UnappliedMerges {
+		request := m.merges[id]
+		request.Status = data.MergeRequestOpen
+		request.DecidedBy = primitive.NilObjectID
+		request.DecidedAt = nil
+		request.UpdatedAt = storedTime(time.Now())
+		m.merges[id] = request
+	}
+
+	report.Repaired = true
+	return report, nil
+}
+
+// recopyFork is the in-memory counterpart of service.recopyFork.
+func (m *memory) recopyFork(forkID primitive.ObjectID) {
+	fork := m.stories[forkID]
+	content := m.contents[forkID].Content
+	if copied, ok := m.revisions[fork.ForkRevision]; ok && content == "" && copied.StoryID == fork.ForkedFrom {
+		revisionID := m.insertRevision(forkID, fork.OwnerID, copied.Content, primitive.NilObjectID)
+		m.setContentHead(forkID, revisionID, copied.Content)
+		content = copied.Content
+	}
+
+	maps.DeleteFunc(m.chapters, func(_ primitive.ObjectID, chapter data.Chapter) bool {
+		return chapter.StoryID == forkID
+	})
+	chapters := m.storyChapters(fork.ForkedFrom)
+	if len(chapters) == 0 || joinChapters(chapters) != content {
+		return
+	}
+	for _, chapter := range chapters {
+		m.insertChapter(newChapter(forkID, chapter.Title, chapter.Order, chapter.Content))
+	}
+}
+
+// Search scores the listed stories with a search.Index built from the
+// current state of the store.
+func (m *memory) Search(ctx context.Context, q search.Query) (*search.Results, error) {
+	index := search.NewIndex()
+
+	m.mu.RLock()
+	for id, story := range m.stories {
+		index.Put(cloneStory(story), m.contents[id].Content)
+	}
+	m.mu.RUnlock()
+
+	return index.Search(ctx, q)
+}
+
+// slicePage is the in-memory counterpart of findPage: it sorts items the way
+// the Mongo query would and cuts out the page after req.Cursor.
+func slicePage[T any](items []T, q pageQuery, req data.PageRequest, keyOf func(*T) (primitive.ObjectID, any)) (*data.Page[T], error) {
+	cursor, err := decodeCursor(req.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != nil && cursor.SortField != q.sortField {
+		return nil, ErrInvalidCursor
+	}
+	limit := PageLimit(req.Limit)
+	backward := cursor != nil && cursor.Backward
+	ascending := q.descending == backward
+
+	compare := func(aID primitive.ObjectID, aValue any, bID primitive.ObjectID, bValue any) int {
+		c := cmp.Or(compareSortValues(aValue, bValue), compareIDs(aID, bID))
+		if !ascending {
+			return -c
+		}
+		return c
+	}
+
+	total := int64(len(items))
+	var matched []T
+	for i := range items {
+		id, value := keyOf(&items[i])
+		if cursor != nil && compare(id, value, cursor.ID, cursor.SortValue) <= 0 {
+			continue
+		}
+		matched = append(matched, items[i])
+	}
+	slices.SortFunc(matched, func(a, b T) int {
+		aID, aValue := keyOf(&a)
+		bID, bValue := keyOf(&b)
+		return compare(aID, aValue, bID, bValue)
+	})
+
+	hasMore := len(matched) > limit
+	if hasMore {
+		matched = matched[:limit]
+	}
+	if backward {
+		slices.Reverse(matched)
+	}
+
+	page := &data.Page[T]{Items: append([]T{}, matched...)}
+	cursorAt := func(item *T, backward bool) string {
+		id, value := keyOf(item)
+		c := pageCursor{ID: id, Backward: backward}
+		if q.sortField != "" {
+			c.SortField, c.SortValue = q.sortField, value
+		}
+		return encodeCursor(c)
+	}
+	if len(page.Items) > 0 {
+		if (!backward && hasMore) || backward {
+			page.NextCursor = cursorAt(&page.Items[len(page.Items)-1], false)
+		}
+		if (backward && hasMore) || (!backward && cursor != nil) {
+			page.PrevCursor = cursorAt(&page.Items[0], true)
+		}
+	}
+
+	if req.WithTotal {
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+func compareIDs(a, b primitive.ObjectID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// compareSortValues orders two sort key values, accepting both the Go types
+// stories hold and the BSON types they come back as from a decoded cursor.
+func compareSortValues(a, b any) int {
+	switch a := normalizeSortValue(a).(type) {
+	case int64:
+		if b, ok := normalizeSortValue(b).(int64); ok {
+			return cmp.Compare(a, b)
+		}
+	case string:
+		if b, ok := normalizeSortValue(b).(string); ok {
+			return cmp.Compare(a, b)
+		}
+	}
+	return 0
+}
+
+func normalizeSortValue(v any) any {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UnixMilli()
+	case primitive.DateTime:
+		return int64(v)
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	}
+	return v
+}
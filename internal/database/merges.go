@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// CreateMergeRequest opens req and returns its ID. A fork can have only one
+// open merge request at a time.
+func (s *service) CreateMergeRequest(ctx context.Context, req *data.MergeRequest) (primitive.ObjectID, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	req.Status = data.MergeRequestOpen
+	req.Comments = []data.MergeComment{}
+	req.CreatedAt = now
+	req.UpdatedAt = now
+
+	// The unique index on open requests per fork backs this check up when
+	// two requests race.
+	err := s.mergeRequests().FindOne(ctx, primitive.M{"fork_id": req.ForkID, "status": data.MergeRequestOpen}).Err()
+	if err == nil {
+		return primitive.NilObjectID, conflict("this fork already has an open merge request")
+	}
+	if err != mongo.ErrNoDocuments {
+		return primitive.NilObjectID, fmt.Errorf("error checking open merge requests: %v", err)
+	}
+
+	res, err := s.mergeRequests().InsertOne(ctx, req)
+	if mongo.IsDuplicateKeyError(err) {
+		return primitive.NilObjectID, conflict("this fork already has an open merge request")
+	}
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error inserting merge request: %v", err)
+	}
+
+	return res.InsertedID.(primitive.ObjectID), nil
+}
+
+func (s *service) GetMergeRequest(ctx context.Context, id primitive.ObjectID) (*data.MergeRequest, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var request data.MergeRequest
+	err := s.mergeRequests().FindOne(ctx, primitive.M{"_id": id}).Decode(&request)
+	if err == mongo.ErrNoDocuments {
+		return nil, notFound("merge request not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching merge request: %v", err)
+	}
+
+	return &request, nil
+}
+
+// GetMergeRequests lists the merge requests proposed to a story, newest
+// first, without their content or comments. An empty status lists them all.
+func (s *service) GetMergeRequests(ctx context.Context, storyID primitive.ObjectID, status data.MergeRequestStatus, page data.PageRequest) (*data.Page[data.MergeRequest], error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter := primitive.M{"story_id": storyID}
+	if status != "" {
+		filter["status"] = status
+	}
+	q := pageQuery{
+		filter:     filter,
+		descending: true,
+		projection: primitive.M{"content": 0, "comments": 0},
+	}
+
+	coll := s.mergeRequests()
+	return findPage(ctx, coll, q, page, func(r *data.MergeRequest) (primitive.ObjectID, any) { return r.ID, nil })
+}
+
+// AddMergeComment appends a comment by authorID to a merge request's thread
+// and returns the comment's ID.
+func (s *service) AddMergeComment(ctx context.Context, id, authorID primitive.ObjectID, body string) (primitive.ObjectID, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	comment := data.MergeComment{
+		ID:        primitive.NewObjectID(),
+		AuthorID:  authorID,
+		Body:      body,
+		CreatedAt: now,
+	}
+	update := primitive.M{
+		"$push": primitive.M{"comments": comment},
+		"$set":  primitive.M{"updated_at": now},
+	}
+
+	res, err := s.mergeRequests().UpdateOne(ctx, primitive.M{"_id": id}, update)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error adding merge request comment: %v", err)
+	}
+	if res.MatchedCount == 0 {
+		return primitive.NilObjectID, notFound("merge request not found")
+	}
+
+	return comment.ID, nil
+}
+
+// AcceptMergeRequest applies an open merge request's content to the upstream
+// story as a new revision by the request's author, the same way an edit
+// would, and returns the revision's ID.
+func (s *service) AcceptMergeRequest(ctx context.Context, id, reviewerID primitive.ObjectID) (primitive.ObjectID, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var revisionID primitive.ObjectID
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		var request data.MergeRequest
+		err := s.mergeRequests().FindOne(ctx, primitive.M{"_id": id}).Decode(&request)
+		if err == mongo.ErrNoDocuments {
+			return notFound("merge request not found")
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching merge request: %v", err)
+		}
+		if request.Status != data.MergeRequestOpen {
+			return conflict("merge request has already been decided")
+		}
+
+		// The content goes in before the request is marked accepted, so
+		// without a transaction a failure in between leaves the request
+		// open to be accepted again rather than accepted with nothing
+		// applied.
+		revisionID, err = s.editStoryContent(ctx, request.StoryID, request.AuthorID, request.Content)
+		if err != nil {
+			return err
+		}
+		return s.decideMergeRequest(ctx, id, primitive.M{
+			"status":      data.MergeRequestAccepted,
+			"decided_by":  reviewerID,
+			"revision_id": revisionID,
+		})
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return revisionID, nil
+}
+
+// RejectMergeRequest closes an open merge request without changing the
+// upstream story.
+func (s *service) RejectMergeRequest(ctx context.Context, id, reviewerID primitive.ObjectID) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err := s.decideMergeRequest(ctx, id, primitive.M{
+		"status":     data.MergeRequestRejected,
+		"decided_by": reviewerID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// decideMergeRequest sets decision on a merge request if it is still open.
+// Requests that are already decided cannot be decided again.
+func (s *service) decideMergeRequest(ctx context.Context, id primitive.ObjectID, decision primitive.M) error {
+	now := time.Now()
+	decision["decided_at"] = now
+	decision["updated_at"] = now
+
+	res, err := s.mergeRequests().UpdateOne(ctx,
+		primitive.M{"_id": id, "status": data.MergeRequestOpen},
+		primitive.M{"$set": decision},
+	)
+	if err != nil {
+		return fmt.Errorf("error deciding merge request: %v", err)
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	count, err := s.mergeRequests().CountDocuments(ctx, primitive.M{"_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("error fetching merge request: %v", err)
+	}
+	if count == 0 {
+		return notFound("merge request not found")
+	}
+	return conflict("merge request has already been decided")
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+var ErrInvalidCursor = invalid(nil, "invalid cursor")
+
+// pageCursor is the decoded form of the opaque cursors handed to clients. It
+// points at the item a page starts after, in the direction given. It is
+// BSON encoded so sort values keep their type across the round trip.
+type pageCursor struct {
+	ID        primitive.ObjectID `bson:"i"`
+	SortField string             `bson:"s,omitempty"`
+	SortValue any                `bson:"v,omitempty"`
+	Backward  bool               `bson:"b,omitempty"`
+}
+
+func encodeCursor(c pageCursor) string {
+	raw, _ := bson.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(token string) (*pageCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c pageCursor
+	if err := bson.Unmarshal(raw, &c); err != nil || c.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// PageLimit clamps a requested page size to [1, MaxPageLimit], using
+// DefaultPageLimit when none was given.
+func PageLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageLimit
+	}
+	return min(limit, MaxPageLimit)
+}
+
+// pageQuery describes a keyset-paginated listing. Items are ordered by
+// sortField, when set, with _id breaking ties in the same direction.
+type pageQuery struct {
+	filter     primitive.M
+	sortField  string
+	descending bool
+	projection primitive.M
+}
+
+// storySorts maps the allow-listed story orders to the field they sort on.
+// Each has a matching index created by createIndexes.
+var storySorts = map[data.StorySort]struct {
+	field      string
+	descending bool
+}{
+	data.SortNewest:  {"created_at", true},
+	data.SortOldest:  {"created_at", false},
+	data.SortUpdated: {"updated_at", true},
+	data.SortTitle:   {"title", false},
+	data.SortForks:   {"fork_count", true},
+}
+
+// storyPageQuery builds the page query for a story listing in the order
+// requested, falling back to data.DefaultStorySort.
+func storyPageQuery(filter primitive.M, sort data.StorySort) pageQuery {
+	if sort == "" {
+		sort = data.DefaultStorySort
+	}
+	order := storySorts[sort]
+	return pageQuery{filter: filter, sortField: order.field, descending: order.descending}
+}
+
+// findPage fetches one page of coll matching q. Pages are anchored on the
+// sort key of their first and last items rather than an offset, so inserts
+// and deletes between requests never shift items across pages. keyOf returns
+// an item's _id and the value of q.sortField.
+func findPage[T any](ctx context.Context, coll *mongo.Collection, q pageQuery, req data.PageRequest, keyOf func(*T) (primitive.ObjectID, any)) (*data.Page[T], error) {
+	cursor, err := decodeCursor(req.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != nil && cursor.SortField != q.sortField {
+		return nil, ErrInvalidCursor
+	}
+	limit := PageLimit(req.Limit)
+	backward := cursor != nil && cursor.Backward
+
+	// Walking backwards flips the sort so the items closest to the cursor
+	// come first; they are reversed again below.
+	ascending := q.descending == backward
+	filter := primitive.M{}
+	for k, v := range q.filter {
+		filter[k] = v
+	}
+	if cursor != nil {
+		op := "$lt"
+		if ascending {
+			op = "$gt"
+		}
+		after := primitive.M{"_id": primitive.M{op: cursor.ID}}
+		if q.sortField != "" {
+			after = primitive.M{"$or": primitive.A{
+				primitive.M{q.sortField: primitive.M{op: cursor.SortValue}},
+				primitive.M{q.sortField: cursor.SortValue, "_id": primitive.M{op: cursor.ID}},
+			}}
+		}
+		filter = primitive.M{"$and": primitive.A{filter, after}}
+	}
+
+	direction := -1
+	if ascending {
+		direction = 1
+	}
+	sort := primitive.D{{Key: "_id", Value: direction}}
+	if q.sortField != "" {
+		sort = append(primitive.D{{Key: q.sortField, Value: direction}}, sort...)
+	}
+	findOptions := options.Find().
+		SetSort(sort).
+		SetLimit(int64(limit + 1))
+	if q.projection != nil {
+		findOptions.SetProjection(q.projection)
+	}
+
+	res, err := coll.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching page: %v", err)
+	}
+	defer res.Close(ctx)
+
+	items := []T{}
+	if err := res.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("error decoding page: %v", err)
+	}
+
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	if backward {
+		slices.Reverse(items)
+	}
+
+	page := &data.Page[T]{Items: items}
+	cursorAt := func(item *T, backward bool) string {
+		id, value := keyOf(item)
+		c := pageCursor{ID: id, Backward: backward}
+		if q.sortField != "" {
+			c.SortField, c.SortValue = q.sortField, value
+		}
+		return encodeCursor(c)
+	}
+	if len(items) > 0 {
+		if (!backward && hasMore) || backward {
+			page.NextCursor = cursorAt(&items[len(items)-1], false)
+		}
+		if (backward && hasMore) || (!backward && cursor != nil) {
+			page.PrevCursor = cursorAt(&items[0], true)
+		}
+	}
+
+	if req.WithTotal {
+		total, err := coll.CountDocuments(ctx, q.filter)
+		if err != nil {
+			return nil, fmt.Errorf("error counting page total: %v", err)
+		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+// storyKey returns the pagination key function for a story listing sorted on
+// field, one of the storySorts fields.
+func storyKey(field string) func(*data.StoryDetails) (primitive.ObjectID, any) {
+	return func(story *data.StoryDetails) (primitive.ObjectID, any) {
+		switch field {
+		case "created_at":
+			return story.ID, story.CreatedAt
+		case "updated_at":
+			return story.ID, story.UpdatedAt
+		case "title":
+			return story.ID, story.Title
+		case "fork_count":
+			return story.ID, story.ForkCount
+		}
+		return story.ID, nil
+	}
+}
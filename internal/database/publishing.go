@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// PublishStory makes a story published immediately and cancels any pending
+// schedule. The original published_at is kept when a story is republished.
+func (s *service) PublishStory(ctx context.Context, storyID primitive.ObjectID) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: primitive.M{
+			"status":       data.StatusPublished,
+			"published_at": primitive.M{"$ifNull": primitive.A{"$published_at", now}},
+			"updated_at":   now,
+		}}},
+		{{Key: "$unset", Value: "scheduled_at"}},
+	}
+
+	res, err := s.storyDetails().UpdateOne(ctx, primitive.M{"_id": storyID}, pipeline)
+	if err != nil {
+		return false, fmt.Errorf("error publishing story: %v", err)
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+// ScheduleStory keeps a story as a draft until publishAt, when
+// PublishScheduledStories makes it live.
+func (s *service) ScheduleStory(ctx context.Context, storyID primitive.ObjectID, publishAt time.Time) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	update := primitive.M{"$set": primitive.M{
+		"status":       data.StatusDraft,
+		"scheduled_at": publishAt,
+		"updated_at":   time.Now(),
+	}}
+
+	res, err := s.storyDetails().UpdateOne(ctx, primitive.M{"_id": storyID}, update)
+	if err != nil {
+		return false, fmt.Errorf("error scheduling story: %v", err)
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+// UnpublishStory moves a story back to draft or into the archive and cancels
+// any pending schedule.
+func (s *service) UnpublishStory(ctx context.Context, storyID primitive.ObjectID, status data.PublicationStatus) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	update := primitive.M{
+		"$set":   primitive.M{"status": status, "updated_at": time.Now()},
+		"$unset": primitive.M{"scheduled_at": ""},
+	}
+
+	res, err := s.storyDetails().UpdateOne(ctx, primitive.M{"_id": storyID}, update)
+	if err != nil {
+		return false, fmt.Errorf("error unpublishing story: %v", err)
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+// PublishScheduledStories publishes every draft whose scheduled time has
+// passed and returns how many were flipped live. Drafts in the trash wait
+// until they are restored.
+func (s *service) PublishScheduledStories(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeouts.Background)
+	defer cancel()
+
+	now := time.Now()
+	filter := notTrashed(primitive.M{
+		"status":       data.StatusDraft,
+		"scheduled_at": primitive.M{"$lte": now},
+	})
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: primitive.M{
+			"status":       data.StatusPublished,
+			"published_at": "$scheduled_at",
+			"updated_at":   now,
+		}}},
+		{{Key: "$unset", Value: "scheduled_at"}},
+	}
+
+	res, err := s.storyDetails().UpdateMany(ctx, filter, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("error publishing scheduled stories: %v", err)
+	}
+
+	return res.ModifiedCount, nil
+}
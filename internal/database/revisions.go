@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// insertRevision records an immutable snapshot of content for a story and
+// returns its ID. Revisions are never updated once written.
+func (s *service) insertRevision(ctx context.Context, storyID, authorID primitive.ObjectID, content string, restoredFrom primitive.ObjectID) (primitive.ObjectID, error) {
+	revision := data.StoryRevision{
+		StoryID:      storyID,
+		AuthorID:     authorID,
+		Content:      content,
+		Size:         len(content),
+		RestoredFrom: restoredFrom,
+		CreatedAt:    time.Now(),
+	}
+
+	res, err := s.storyRevisions().InsertOne(ctx, revision)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error inserting story revision: %v", err)
+	}
+
+	return res.InsertedID.(primitive.ObjectID), nil
+}
+
+// baselineRevision records a story's current content as a revision by its
+// owner when that content predates revisions and none can bring it back, so
+// the next change to the story does not lose it.
+func (s *service) baselineRevision(ctx context.Context, storyID primitive.ObjectID) error {
+	var head data.StoryContent
+	err := s.storyContent().FindOne(ctx, primitive.M{"story_id": storyID}).Decode(&head)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching story content: %v", err)
+	}
+	if head.Content == "" {
+		return nil
+	}
+	if !head.RevisionID.IsZero() {
+		count, err := s.storyRevisions().CountDocuments(ctx, primitive.M{"story_id": storyID}, options.Count().SetLimit(1))
+		if err != nil {
+			return fmt.Errorf("error counting story revisions: %v", err)
+		}
+		if count > 0 {
+			return nil
+		}
+	}
+
+	var story data.StoryDetails
+	err = s.storyDetails().FindOne(ctx, primitive.M{"_id": storyID}, options.FindOne().SetProjection(primitive.M{"owner_id": 1})).Decode(&story)
+	if err != nil {
+		return fmt.Errorf("error fetching story: %v", err)
+	}
+	revisionID, err := s.insertRevision(ctx, storyID, story.OwnerID, head.Content, primitive.NilObjectID)
+	if err != nil {
+		return err
+	}
+	return s.setContentHead(ctx, storyID, revisionID, head.Content)
+}
+
+// setContentHead points the story's storycontent document at a revision,
+// creating the document if the story has no content yet.
+func (s *service) setContentHead(ctx context.Context, storyID, revisionID primitive.ObjectID, content string) error {
+	filter := primitive.M{"story_id": storyID}
+	update := primitive.M{"$set": primitive.M{"content": content, "revision_id": revisionID}}
+
+	_, err := s.storyContent().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error updating story content: %v", err)
+	}
+
+	return nil
+}
+
+// GetStoryRevisions lists a story's revisions, newest first, without their
+// content.
+func (s *service) GetStoryRevisions(ctx context.Context, storyID primitive.ObjectID, page data.PageRequest) (*data.Page[data.StoryRevision], error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	q := pageQuery{
+		filter:     primitive.M{"story_id": storyID},
+		descending: true,
+		projection: primitive.M{"content": 0},
+	}
+
+	coll := s.storyRevisions()
+	return findPage(ctx, coll, q, page, func(r *data.StoryRevision) (primitive.ObjectID, any) { return r.ID, nil })
+}
+
+func (s *service) GetStoryRevision(ctx context.Context, storyID, revisionID primitive.ObjectID) (*data.StoryRevision, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var revision data.StoryRevision
+	filter := primitive.M{"_id": revisionID, "story_id": storyID}
+	err := s.storyRevisions().FindOne(ctx, filter).Decode(&revision)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, notFound("revision not found")
+		}
+		return nil, fmt.Errorf("error fetching story revision: %v", err)
+	}
+
+	return &revision, nil
+}
+
+// RestoreStoryRevision copies an old revision into a new revision authored by
+// userID and makes it the story's current content. History is never rewritten.
+func (s *service) RestoreStoryRevision(ctx context.Context, storyID, revisionID, userID primitive.ObjectID) (primitive.ObjectID, error) {
+	revision, err := s.GetStoryRevision(ctx, storyID, revisionID)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var newRevisionID primitive.ObjectID
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		if err := s.baselineRevision(ctx, storyID); err != nil {
+			return err
+		}
+		var err error
+		newRevisionID, err = s.insertRevision(ctx, storyID, userID, revision.Content, revision.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.setContentHead(ctx, storyID, newRevisionID, revision.Content); err != nil {
+			return err
+		}
+
+		_, err = s.storyDetails().UpdateOne(ctx, primitive.M{"_id": storyID}, primitive.M{"$set": primitive.M{"updated_at": time.Now()}})
+		if err != nil {
+			return fmt.Errorf("error updating story details: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return newRevisionID, nil
+}
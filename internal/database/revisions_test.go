@@ -0,0 +1,66 @@
+package database
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/config"
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+func TestEditKeepsContentFromBeforeRevisions(t *testing.T) {
+	const legacy = "Written before revisions were kept."
+	owner, editor := primitive.NewObjectID(), primitive.NewObjectID()
+
+	tests := []struct {
+		name string
+		// head is the story's content as an older version left it.
+		head func(storyID primitive.ObjectID) data.StoryContent
+	}{
+		{name: "no revision ID", head: func(storyID primitive.ObjectID) data.StoryContent {
+			return data.StoryContent{ID: primitive.NewObjectID(), StoryID: storyID, Content: legacy}
+		}},
+		{name: "revision ID without revisions", head: func(storyID primitive.ObjectID) data.StoryContent {
+			return data.StoryContent{ID: primitive.NewObjectID(), StoryID: storyID, Content: legacy, RevisionID: primitive.NewObjectID()}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMemory(nil, config.Default().Database.Timeouts)
+			storyID, err := m.CreateStory(t.Context(), &data.StoryDetails{Title: "Old Story", Genre: "drama", OwnerID: owner})
+			if err != nil {
+				t.Fatalf("CreateStory() error = %v", err)
+			}
+			m.contents[storyID] = tt.head(storyID)
+
+			if _, err := m.EditStoryContent(t.Context(), storyID, editor, "Rewritten by an editor."); err != nil {
+				t.Fatalf("EditStoryContent() error = %v", err)
+			}
+
+			revisions, err := m.GetStoryRevisions(t.Context(), storyID, data.PageRequest{})
+			if err != nil {
+				t.Fatalf("GetStoryRevisions() error = %v", err)
+			}
+			if len(revisions.Items) != 2 {
+				t.Fatalf("GetStoryRevisions() = %d revisions, want 2", len(revisions.Items))
+			}
+			baseline := revisions.Items[1]
+			if baseline.AuthorID != owner {
+				t.Errorf("baseline author = %v, want the owner %v", baseline.AuthorID, owner)
+			}
+
+			if _, err := m.RestoreStoryRevision(t.Context(), storyID, baseline.ID, owner); err != nil {
+				t.Fatalf("RestoreStoryRevision() error = %v", err)
+			}
+			content, err := m.GetStoryContent(t.Context(), storyID)
+			if err != nil {
+				t.Fatalf("GetStoryContent() error = %v", err)
+			}
+			if content.Content != legacy {
+				t.Errorf("restored content = %q, want %q", content.Content, legacy)
+			}
+		})
+	}
+}
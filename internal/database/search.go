@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/search"
+)
+
+// maxSearchCandidates caps how many matches are pulled from each text index
+// before scores are merged and paginated.
+const maxSearchCandidates = 500
+
+// textSearch is a search.Engine backed by the Mongo text indexes on
+// the story details and content collections.
+type textSearch struct {
+	details *mongo.Collection
+	content *mongo.Collection
+	timeout time.Duration
+}
+
+// NewSearchEngine returns a search.Engine sharing db's Mongo client, or db
+// itself when it can search its own stories. Any other Service
+// implementation gets an empty in-process index.
+func NewSearchEngine(db Service) search.Engine {
+	if s, ok := db.(*service); ok {
+		return &textSearch{details: s.storyDetails(), content: s.storyContent(), timeout: s.timeouts.Operation}
+	}
+	if engine, ok := db.(search.Engine); ok {
+		return engine
+	}
+	return search.NewIndex()
+}
+
+// createTextIndexes creates the weighted text indexes used by textSearch.
+func (s *service) createTextIndexes(ctx context.Context) error {
+	_, err := s.storyDetails().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{{Key: "title", Value: "text"}, {Key: "description", Value: "text"}},
+		Options: options.Index().
+			SetName("storydetails_text").
+			SetWeights(primitive.M{"title": search.TitleWeight, "description": search.DescriptionWeight}),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating story details text index: %v", err)
+	}
+
+	_, err = s.storyContent().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{{Key: "content", Value: "text"}},
+		Options: options.Index().
+			SetName("storycontent_text").
+			SetWeights(primitive.M{"content": search.ContentWeight}),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating story content text index: %v", err)
+	}
+
+	return nil
+}
+
+// Search runs the query against both text indexes and adds up the scores
+// per story, since Mongo cannot combine text searches across collections.
+func (t *textSearch) Search(ctx context.Context, q search.Query) (*search.Results, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	storyFilter := func() primitive.M {
+		filter := listedFilter()
+		if len(q.Genres) > 0 {
+			filter["genre"] = primitive.M{"$in": q.Genres}
+		}
+		return filter
+	}
+	textFilter := primitive.M{"$search": q.Text}
+	textScore := primitive.M{"$meta": "textScore"}
+
+	detailsFilter := storyFilter()
+	detailsFilter["$text"] = textFilter
+	detailsOptions := options.Find().
+		SetProjection(primitive.M{"score": textScore}).
+		SetSort(primitive.M{"score": textScore}).
+		SetLimit(maxSearchCandidates)
+
+	cursor, err := t.details.Find(ctx, detailsFilter, detailsOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error searching story details: %v", err)
+	}
+	var detailMatches []struct {
+		data.StoryDetails `bson:",inline"`
+		Score             float64 `bson:"score"`
+	}
+	if err := cursor.All(ctx, &detailMatches); err != nil {
+		return nil, fmt.Errorf("error decoding story details matches: %v", err)
+	}
+
+	hits := make(map[primitive.ObjectID]*search.Hit, len(detailMatches))
+	for _, match := range detailMatches {
+		hits[match.ID] = &search.Hit{Story: match.StoryDetails, Score: match.Score}
+	}
+
+	contentOptions := options.Find().
+		SetProjection(primitive.M{"story_id": 1, "score": textScore}).
+		SetSort(primitive.M{"score": textScore}).
+		SetLimit(maxSearchCandidates)
+	cursor, err = t.content.Find(ctx, primitive.M{"$text": textFilter}, contentOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error searching story content: %v", err)
+	}
+	var contentMatches []struct {
+		StoryID primitive.ObjectID `bson:"story_id"`
+		Score   float64            `bson:"score"`
+	}
+	if err := cursor.All(ctx, &contentMatches); err != nil {
+		return nil, fmt.Errorf("error decoding story content matches: %v", err)
+	}
+
+	contentScores := make(map[primitive.ObjectID]float64, len(contentMatches))
+	var missing []primitive.ObjectID
+	for _, match := range contentMatches {
+		contentScores[match.StoryID] = match.Score
+		if _, ok := hits[match.StoryID]; !ok {
+			missing = append(missing, match.StoryID)
+		}
+	}
+
+	// Stories matched only on content still have to pass the listing and
+	// genre filters.
+	if len(missing) > 0 {
+		missingFilter := storyFilter()
+		missingFilter["_id"] = primitive.M{"$in": missing}
+		cursor, err = t.details.Find(ctx, missingFilter)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching matched stories: %v", err)
+		}
+		var stories []data.StoryDetails
+		if err := cursor.All(ctx, &stories); err != nil {
+			return nil, fmt.Errorf("error decoding matched stories: %v", err)
+		}
+		for _, story := range stories {
+			hits[story.ID] = &search.Hit{Story: story}
+		}
+	}
+
+	ranked := make([]search.Hit, 0, len(hits))
+	for id, hit := range hits {
+		hit.Score += contentScores[id]
+		ranked = append(ranked, *hit)
+	}
+
+	return search.Rank(ranked, q)
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// supportsTransactions reports whether client is connected to a replica set
+// or a sharded cluster. Standalone servers reject transactions.
+func supportsTransactions(ctx context.Context, client *mongo.Client) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false, fmt.Errorf("error running hello: %v", err)
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
+// withTransaction runs fn inside a transaction, so its writes apply all
+// together or not at all. fn must do its work with the context it is given,
+// and may run more than once if the transaction is retried.
+//
+// On a deployment without transactions fn runs directly and a failure
+// midway leaves its earlier writes in place. CheckConsistency finds what
+// such failures leave behind and can repair it.
+func (s *service) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !s.transactions {
+		return fn(ctx)
+	}
+
+	session, err := s.db.StartSession()
+	if err != nil {
+		return fmt.Errorf("error starting session: %v", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
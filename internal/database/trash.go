@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// notTrashed narrows filter to stories that are not in the trash. Everything
+// but the trash methods below reads through it, so a trashed story is gone
+// as far as the rest of the service is concerned.
+func notTrashed(filter primitive.M) primitive.M {
+	filter["deleted_at"] = nil
+	return filter
+}
+
+// restorableFilter matches the stories trashed within retention.
+func restorableFilter(retention time.Duration) primitive.M {
+	return primitive.M{"deleted_at": primitive.M{"$gte": time.Now().Add(-retention)}}
+}
+
+// GetTrash lists the stories userID deleted within retention, which can
+// still be restored.
+func (s *service) GetTrash(ctx context.Context, userID primitive.ObjectID, retention time.Duration, page data.PageRequest) (*data.Page[data.StoryDetails], error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter := restorableFilter(retention)
+	filter["owner_id"] = userID
+
+	q := storyPageQuery(filter, page.Sort)
+	coll := s.storyDetails()
+	return findPage(ctx, coll, q, page, storyKey(q.sortField))
+}
+
+// GetTrashedStory returns a story deleted within retention.
+func (s *service) GetTrashedStory(ctx context.Context, id primitive.ObjectID, retention time.Duration) (*data.StoryDetails, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter := restorableFilter(retention)
+	filter["_id"] = id
+
+	var story data.StoryDetails
+	err := s.storyDetails().FindOne(ctx, filter).Decode(&story)
+	if err == mongo.ErrNoDocuments {
+		return nil, notFound("story not found in trash")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching story: %v", err)
+	}
+
+	return &story, nil
+}
+
+// RestoreStory takes a story deleted within retention out of the trash. A
+// restored fork counts towards its parent again, unless its owner has forked
+// the same story since, in which case it stays in the trash.
+func (s *service) RestoreStory(ctx context.Context, storyID primitive.ObjectID, retention time.Duration) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		filter := restorableFilter(retention)
+		filter["_id"] = storyID
+		update := primitive.M{
+			"$set":   primitive.M{"updated_at": time.Now()},
+			"$unset": primitive.M{"deleted_at": ""},
+		}
+
+		// The fork is checked before anything is written, so a conflict
+		// cannot leave the story half restored.
+		var trashed data.StoryDetails
+		err := s.storyDetails().FindOne(ctx, filter).Decode(&trashed)
+		if err == mongo.ErrNoDocuments {
+			return notFound("story not found in trash")
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching story: %v", err)
+		}
+		if !trashed.ForkedFrom.IsZero() {
+			others, err := s.storyDetails().CountDocuments(ctx, notTrashed(primitive.M{
+				"forked_from": trashed.ForkedFrom,
+				"owner_id":    trashed.OwnerID,
+			}))
+			if err != nil {
+				return fmt.Errorf("error checking existing forks: %v", err)
+			}
+			if others > 0 {
+				return conflict("you have forked this story again since deleting this fork")
+			}
+		}
+
+		res, err := s.storyDetails().UpdateOne(ctx, filter, update)
+		if err != nil {
+			return fmt.Errorf("error restoring story: %v", err)
+		}
+		if res.MatchedCount == 0 {
+			return notFound("story not found in trash")
+		}
+		if trashed.ForkedFrom.IsZero() {
+			return nil
+		}
+
+		filter = primitive.M{"_id": trashed.ForkedFrom}
+		if _, err := s.storyDetails().UpdateOne(ctx, filter, primitive.M{"$inc": primitive.M{"fork_count": 1}}); err != nil {
+			return fmt.Errorf("error updating fork count: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PurgeTrash permanently deletes the stories that have been in the trash for
+// longer than retention, along with their content, revisions and chapters,
+// and returns how many it deleted.
+func (s *service) PurgeTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeouts.Background)
+	defer cancel()
+
+	var purged int64
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		cursor, err := s.storyDetails().Find(ctx,
+			primitive.M{"deleted_at": primitive.M{"$lt": time.Now().Add(-retention)}},
+			options.Find().SetProjection(primitive.M{"_id": 1, "forked_from": 1, "deleted_at": 1}),
+		)
+		if err != nil {
+			return fmt.Errorf("error finding expired stories: %v", err)
+		}
+		var expired []data.StoryDetails
+		if err := cursor.All(ctx, &expired); err != nil {
+			return fmt.Errorf("error decoding expired stories: %v", err)
+		}
+		if len(expired) == 0 {
+			return nil
+		}
+
+		storyIDs := make([]primitive.ObjectID, 0, len(expired))
+		for _, story := range expired {
+			storyIDs = append(storyIDs, story.ID)
+		}
+		res, err := s.storyDetails().DeleteMany(ctx, primitive.M{"_id": primitive.M{"$in": storyIDs}})
+		if err != nil {
+			return fmt.Errorf("error purging stories: %v", err)
+		}
+		purged = res.DeletedCount
+
+		return s.deleteStoryData(ctx, expired)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,288 @@
+// Package diff computes line and word level differences between two texts
+// and renders them as hunks or as a unified diff.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+type Granularity string
+
+const (
+	ByLine Granularity = "line"
+	ByWord Granularity = "word"
+)
+
+// DefaultContext is the number of unchanged tokens kept around each change.
+const DefaultContext = 3
+
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Edits    []Edit `json:"edits"`
+}
+
+// Split breaks text into the tokens compared at the given granularity.
+func Split(text string, granularity Granularity) []string {
+	if granularity == ByWord {
+		return strings.Fields(text)
+	}
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Compute returns the shortest edit script turning a into b.
+func Compute(a, b []string) []Edit {
+	var edits []Edit
+	compare(a, b, &edits)
+	return edits
+}
+
+func compare(a, b []string, edits *[]Edit) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for _, t := range a[:prefix] {
+		*edits = append(*edits, Edit{Op: Equal, Text: t})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	switch {
+	case len(midA) == 0:
+		for _, t := range midB {
+			*edits = append(*edits, Edit{Op: Insert, Text: t})
+		}
+	case len(midB) == 0:
+		for _, t := range midA {
+			*edits = append(*edits, Edit{Op: Delete, Text: t})
+		}
+	default:
+		x, y, ok := bisect(midA, midB)
+		if ok {
+			compare(midA[:x], midB[:y], edits)
+			compare(midA[x:], midB[y:], edits)
+		} else {
+			for _, t := range midA {
+				*edits = append(*edits, Edit{Op: Delete, Text: t})
+			}
+			for _, t := range midB {
+				*edits = append(*edits, Edit{Op: Insert, Text: t})
+			}
+		}
+	}
+
+	for _, t := range a[len(a)-suffix:] {
+		*edits = append(*edits, Edit{Op: Equal, Text: t})
+	}
+}
+
+// bisect finds the middle snake of Myers' algorithm so the problem can be
+// split in two, keeping memory linear in the size of the inputs.
+func bisect(a, b []string) (int, int, bool) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+	vf := make([]int, size)
+	vb := make([]int, size)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	delta := n - m
+	front := delta%2 != 0
+	kfStart, kfEnd, kbStart, kbEnd := 0, 0, 0, 0
+
+	for d := 0; d < maxD; d++ {
+		for k := -d + kfStart; k <= d-kfEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -d || (k != d && vf[i-1] < vf[i+1]) {
+				x = vf[i+1]
+			} else {
+				x = vf[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[i] = x
+			if x > n {
+				kfEnd += 2
+			} else if y > m {
+				kfStart += 2
+			} else if front {
+				j := offset + delta - k
+				if j >= 0 && j < size && vb[j] != -1 && x >= n-vb[j] {
+					return x, y, true
+				}
+			}
+		}
+
+		for k := -d + kbStart; k <= d-kbEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -d || (k != d && vb[i-1] < vb[i+1]) {
+				x = vb[i+1]
+			} else {
+				x = vb[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			vb[i] = x
+			if x > n {
+				kbEnd += 2
+			} else if y > m {
+				kbStart += 2
+			} else if !front {
+				j := offset + delta - k
+				if j >= 0 && j < size && vf[j] != -1 {
+					fx := vf[j]
+					fy := offset + fx - j
+					if fx >= n-x {
+						return fx, fy, true
+					}
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// Hunks groups an edit script into hunks carrying context unchanged tokens
+// on each side of a change. Changes closer than 2*context are merged.
+func Hunks(edits []Edit, context int) []Hunk {
+	if context < 0 {
+		context = 0
+	}
+
+	var hunks []Hunk
+	var current *Hunk
+	oldLine, newLine := 1, 1
+	trailing := 0
+
+	for i, e := range edits {
+		if e.Op != Equal {
+			if current == nil {
+				start := max(i-context, 0)
+				for j := start; j < i; j++ {
+					if edits[j].Op != Equal {
+						start = j + 1
+					}
+				}
+				lead := i - start
+				current = &Hunk{OldStart: oldLine - lead, NewStart: newLine - lead}
+				for _, c := range edits[start:i] {
+					current.Edits = append(current.Edits, c)
+					current.OldLines++
+					current.NewLines++
+				}
+			}
+			current.Edits = append(current.Edits, e)
+			if e.Op == Delete {
+				current.OldLines++
+				oldLine++
+			} else {
+				current.NewLines++
+				newLine++
+			}
+			trailing = 0
+			continue
+		}
+
+		if current != nil {
+			if trailing < context || nextChangeWithin(edits, i, 2*context-trailing+1) {
+				current.Edits = append(current.Edits, e)
+				current.OldLines++
+				current.NewLines++
+				trailing++
+			} else {
+				hunks = append(hunks, finish(*current))
+				current = nil
+				trailing = 0
+			}
+		}
+		oldLine++
+		newLine++
+	}
+	if current != nil {
+		hunks = append(hunks, finish(*current))
+	}
+
+	return hunks
+}
+
+// nextChangeWithin reports whether a non-equal edit occurs within n tokens
+// starting at index i.
+func nextChangeWithin(edits []Edit, i, n int) bool {
+	for j := i; j < len(edits) && j < i+n; j++ {
+		if edits[j].Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// finish points the start of an empty range at the line preceding it, the
+// way unified diffs expect.
+func finish(h Hunk) Hunk {
+	if h.OldLines == 0 {
+		h.OldStart--
+	}
+	if h.NewLines == 0 {
+		h.NewStart--
+	}
+	return h
+}
+
+// Unified renders hunks as a unified diff between oldName and newName.
+func Unified(oldName, newName string, hunks []Hunk) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		for _, e := range h.Edits {
+			switch e.Op {
+			case Insert:
+				sb.WriteByte('+')
+			case Delete:
+				sb.WriteByte('-')
+			default:
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(e.Text)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,130 @@
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name        string
+		a, b        string
+		granularity Granularity
+		want        []Edit
+	}{
+		{name: "both empty", granularity: ByLine, want: nil},
+		{name: "empty old", b: "one\ntwo\n", granularity: ByLine,
+			want: []Edit{{Insert, "one"}, {Insert, "two"}}},
+		{name: "empty new", a: "one\ntwo\n", granularity: ByLine,
+			want: []Edit{{Delete, "one"}, {Delete, "two"}}},
+		{name: "identical", a: "one\ntwo\n", b: "one\ntwo\n", granularity: ByLine,
+			want: []Edit{{Equal, "one"}, {Equal, "two"}}},
+		{name: "missing trailing newline", a: "one\ntwo", b: "one\ntwo\n", granularity: ByLine,
+			want: []Edit{{Equal, "one"}, {Equal, "two"}}},
+		{name: "changed line", a: "one\ntwo\nthree\n", b: "one\n2\nthree\n", granularity: ByLine,
+			want: []Edit{{Equal, "one"}, {Delete, "two"}, {Insert, "2"}, {Equal, "three"}}},
+		{name: "words", a: "the quick brown fox", b: "the  slow brown\nfox", granularity: ByWord,
+			want: []Edit{{Equal, "the"}, {Delete, "quick"}, {Insert, "slow"}, {Equal, "brown"}, {Equal, "fox"}}},
+		{name: "words ignore line breaks", a: "a dragon\nslept", b: "a\ndragon slept", granularity: ByWord,
+			want: []Edit{{Equal, "a"}, {Equal, "dragon"}, {Equal, "slept"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compute(Split(tt.a, tt.granularity), Split(tt.b, tt.granularity))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Compute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{name: "append", a: "one\ntwo\n", b: "one\ntwo\nthree\n"},
+		{name: "prepend", a: "two\nthree\n", b: "one\ntwo\nthree\n"},
+		{name: "replace everything", a: "a\nb\nc\n", b: "x\ny\n"},
+		{name: "reorder", a: "a\nb\nc\nd\ne\n", b: "e\nd\nc\nb\na\n"},
+		{name: "scattered edits", a: "a\nb\nc\nd\ne\nf\ng\nh\n", b: "a\nB\nc\nd\nx\ne\nf\nh\ni\n"},
+		{name: "repeated lines", a: "x\nx\ny\nx\nx\n", b: "x\ny\ny\nx\nx\nx\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := Split(tt.a, ByLine), Split(tt.b, ByLine)
+			edits := Compute(a, b)
+			if got := apply(edits, Insert); !slices.Equal(got, a) {
+				t.Errorf("source from edits = %q, want %q", got, a)
+			}
+			if got := apply(edits, Delete); !slices.Equal(got, b) {
+				t.Errorf("target from edits = %q, want %q", got, b)
+			}
+		})
+	}
+}
+
+// apply replays edits, skipping those with the given op: skipping inserts
+// gives back the source and skipping deletes gives the target.
+func apply(edits []Edit, skip Op) []string {
+	var tokens []string
+	for _, e := range edits {
+		if e.Op != skip {
+			tokens = append(tokens, e.Text)
+		}
+	}
+	return tokens
+}
+
+func TestHunks(t *testing.T) {
+	// lines returns a text of n numbered lines with the given lines changed.
+	lines := func(n int, changed ...int) string {
+		var sb strings.Builder
+		for i := 1; i <= n; i++ {
+			if slices.Contains(changed, i) {
+				fmt.Fprintf(&sb, "changed %d\n", i)
+			} else {
+				fmt.Fprintf(&sb, "line %d\n", i)
+			}
+		}
+		return sb.String()
+	}
+	type span struct{ oldStart, oldLines, newStart, newLines int }
+
+	tests := []struct {
+		name string
+		a, b string
+		want []span
+	}{
+		{name: "no changes", a: lines(10), b: lines(10), want: nil},
+		{name: "single change", a: lines(20), b: lines(20, 10),
+			want: []span{{7, 7, 7, 7}}},
+		{name: "change at the start", a: lines(20), b: lines(20, 1),
+			want: []span{{1, 4, 1, 4}}},
+		{name: "gap of twice the context merges", a: lines(20), b: lines(20, 5, 5+2*DefaultContext+1),
+			want: []span{{2, 14, 2, 14}}},
+		{name: "wider gap splits", a: lines(20), b: lines(20, 5, 5+2*DefaultContext+2),
+			want: []span{{2, 7, 2, 7}, {10, 7, 10, 7}}},
+		{name: "insert into empty", a: "", b: "one\n",
+			want: []span{{0, 0, 1, 1}}},
+		{name: "delete everything", a: "one\ntwo\n", b: "",
+			want: []span{{1, 2, 0, 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks := Hunks(Compute(Split(tt.a, ByLine), Split(tt.b, ByLine)), DefaultContext)
+			var got []span
+			for _, h := range hunks {
+				got = append(got, span{h.OldStart, h.OldLines, h.NewStart, h.NewLines})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Hunks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
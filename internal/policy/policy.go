@@ -0,0 +1,97 @@
+// Package policy decides what a user may do to a story based on the role
+// they hold on it. Handlers ask Can instead of inspecting story fields.
+package policy
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+type Action string
+
+const (
+	ViewStory           Action = "view_story"
+	CommentOnStory      Action = "comment_on_story"
+	EditContent         Action = "edit_content"
+	EditMetadata        Action = "edit_metadata"
+	ManageCollaborators Action = "manage_collaborators"
+	TransferOwnership   Action = "transfer_ownership"
+	DeleteStory         Action = "delete_story"
+	RestoreStory        Action = "restore_story"
+	ForkStory           Action = "fork_story"
+	ChangeVisibility    Action = "change_visibility"
+	PublishStory        Action = "publish_story"
+	LeaveStory          Action = "leave_story"
+	// ProposeMerge is checked on the fork a merge request comes from,
+	// ReviewMerge on the story it is proposed to.
+	ProposeMerge Action = "propose_merge"
+	ReviewMerge  Action = "review_merge"
+)
+
+var rank = map[data.Role]int{
+	data.RoleNone:      0,
+	data.RoleViewer:    1,
+	data.RoleCommenter: 2,
+	data.RoleEditor:    3,
+	data.RoleOwner:     4,
+}
+
+// minimumRole is the least privileged role allowed to perform each action.
+var minimumRole = map[Action]data.Role{
+	ViewStory:           data.RoleNone,
+	CommentOnStory:      data.RoleCommenter,
+	EditContent:         data.RoleEditor,
+	EditMetadata:        data.RoleOwner,
+	ManageCollaborators: data.RoleOwner,
+	TransferOwnership:   data.RoleOwner,
+	DeleteStory:         data.RoleOwner,
+	RestoreStory:        data.RoleOwner,
+	ForkStory:           data.RoleNone,
+	ChangeVisibility:    data.RoleOwner,
+	PublishStory:        data.RoleOwner,
+	LeaveStory:          data.RoleViewer,
+	ProposeMerge:        data.RoleOwner,
+	ReviewMerge:         data.RoleOwner,
+}
+
+// Can reports whether userID may perform action on story. Anonymous callers
+// are passed as primitive.NilObjectID.
+func Can(story *data.StoryDetails, userID primitive.ObjectID, action Action) bool {
+	if story == nil {
+		return false
+	}
+	role := story.RoleOf(userID)
+
+	// A story in the trash is gone for everyone, and all its owner may do
+	// is bring it back. Stories outside the trash have nothing to restore.
+	if story.Trashed() != (action == RestoreStory) {
+		return false
+	}
+
+	// Private stories and drafts are invisible to anyone without a role, so
+	// nothing else about them is permitted either.
+	hidden := story.EffectiveVisibility() == data.VisibilityPrivate || story.EffectiveStatus() == data.StatusDraft
+	if hidden && role == data.RoleNone {
+		return false
+	}
+
+	switch action {
+	case ForkStory:
+		// Owners already have the story; everyone else may copy it.
+		if role == data.RoleOwner {
+			return false
+		}
+	case LeaveStory:
+		// Owners must transfer ownership before they can walk away.
+		if role == data.RoleOwner {
+			return false
+		}
+	}
+
+	required, ok := minimumRole[action]
+	if !ok {
+		return false
+	}
+	return rank[role] >= rank[required]
+}
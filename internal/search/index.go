@@ -0,0 +1,85 @@
+package search
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// Index is an in-process Engine that scores stories by weighted term
+// frequency. It needs no Mongo text indexes and is safe for concurrent use.
+type Index struct {
+	mu   sync.RWMutex
+	docs map[primitive.ObjectID]document
+}
+
+type document struct {
+	story       data.StoryDetails
+	title       map[string]int
+	description map[string]int
+	content     map[string]int
+}
+
+func NewIndex() *Index {
+	return &Index{docs: make(map[primitive.ObjectID]document)}
+}
+
+// Put adds or replaces a story and its content in the index.
+func (i *Index) Put(story data.StoryDetails, content string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.docs[story.ID] = document{
+		story:       story,
+		title:       termCounts(story.Title),
+		description: termCounts(story.Description),
+		content:     termCounts(content),
+	}
+}
+
+func (i *Index) Remove(id primitive.ObjectID) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.docs, id)
+}
+
+func (i *Index) Search(ctx context.Context, q Query) (*Results, error) {
+	terms := Tokenize(q.Text)
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var hits []Hit
+	for _, doc := range i.docs {
+		if !Listed(&doc.story) {
+			continue
+		}
+		if len(q.Genres) > 0 && !slices.Contains(q.Genres, doc.story.Genre) {
+			continue
+		}
+		score := 0
+		for _, term := range terms {
+			score += doc.title[term]*TitleWeight +
+				doc.description[term]*DescriptionWeight +
+				doc.content[term]*ContentWeight
+		}
+		if score > 0 {
+			hits = append(hits, Hit{Story: doc.story, Score: float64(score)})
+		}
+	}
+
+	return Rank(hits, q)
+}
+
+func termCounts(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, term := range Tokenize(text) {
+		counts[term]++
+	}
+	return counts
+}
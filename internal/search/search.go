@@ -0,0 +1,148 @@
+// Package search ranks stories against free-text queries. Engine is the
+// seam between handlers and whatever backs the search: Mongo text indexes in
+// production or the in-process Index in tests and local development.
+package search
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// Field weights shared by every engine so rankings agree between them.
+const (
+	TitleWeight       = 10
+	DescriptionWeight = 5
+	ContentWeight     = 1
+)
+
+// ErrInvalidCursor is returned for a Query.Cursor that Rank did not issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query is one page of a search. An empty Cursor starts from the best match;
+// Limit is used as given, so callers clamp it first.
+type Query struct {
+	Text   string
+	Genres []string
+	Cursor string
+	Limit  int
+}
+
+type Hit struct {
+	Story data.StoryDetails `json:"story"`
+	Score float64           `json:"score"`
+}
+
+// Results is one page of hits. The cursors are passed back in Query.Cursor
+// and are empty when there is nothing further in that direction. Total
+// counts every match, not just this page.
+type Results struct {
+	Hits       []Hit  `json:"hits"`
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+	Total      int    `json:"total"`
+}
+
+// Engine searches listed stories, public and published, by relevance.
+type Engine interface {
+	Search(ctx context.Context, q Query) (*Results, error)
+}
+
+// hitCursor points at the hit a page starts after, in the direction given.
+// Pages are anchored on a hit's score and ID rather than an offset, the same
+// way listings are, so a story gaining or losing matches between requests
+// does not shift the rest across pages.
+type hitCursor struct {
+	ID       primitive.ObjectID `bson:"i"`
+	Score    float64            `bson:"s"`
+	Backward bool               `bson:"b,omitempty"`
+}
+
+func encodeCursor(c hitCursor) string {
+	raw, _ := bson.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(token string) (*hitCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c hitCursor
+	if err := bson.Unmarshal(raw, &c); err != nil || c.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// compareHits orders hits by descending score, breaking ties by story ID so
+// pages are stable.
+func compareHits(aScore float64, aID primitive.ObjectID, bScore float64, bID primitive.ObjectID) int {
+	return cmp.Or(cmp.Compare(bScore, aScore), strings.Compare(aID.Hex(), bID.Hex()))
+}
+
+// Rank sorts hits by relevance and returns the page after, or before,
+// q.Cursor.
+func Rank(hits []Hit, q Query) (*Results, error) {
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(hits, func(a, b Hit) int {
+		return compareHits(a.Score, a.Story.ID, b.Score, b.Story.ID)
+	})
+
+	// Hits before the cursor's position belong to earlier pages; the hit
+	// it was issued for, if still there, belongs to neither side.
+	start, end := 0, min(q.Limit, len(hits))
+	if cursor != nil {
+		at, found := slices.BinarySearchFunc(hits, cursor, func(hit Hit, c *hitCursor) int {
+			return compareHits(hit.Score, hit.Story.ID, c.Score, c.ID)
+		})
+		if cursor.Backward {
+			start, end = max(at-q.Limit, 0), at
+		} else {
+			if found {
+				at++
+			}
+			start, end = at, min(at+q.Limit, len(hits))
+		}
+	}
+
+	results := &Results{Hits: append([]Hit{}, hits[start:end]...), Total: len(hits)}
+	if len(results.Hits) > 0 {
+		if end < len(hits) {
+			last := results.Hits[len(results.Hits)-1]
+			results.NextCursor = encodeCursor(hitCursor{ID: last.Story.ID, Score: last.Score})
+		}
+		if start > 0 {
+			first := results.Hits[0]
+			results.PrevCursor = encodeCursor(hitCursor{ID: first.Story.ID, Score: first.Score, Backward: true})
+		}
+	}
+	return results, nil
+}
+
+// Tokenize lowercases text and splits it into words.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Listed reports whether a story may appear in search results.
+func Listed(story *data.StoryDetails) bool {
+	return !story.Trashed() && story.EffectiveVisibility() == data.VisibilityPublic && story.EffectiveStatus() == data.StatusPublished
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// AdminMiddleware lets through only the users listed in Config.Admins. It
+// must run after JWTMiddleware.
+func (s *Server) AdminMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !slices.Contains(s.config.Admins, callerID(c)) {
+				return forbidden()
+			}
+			return next(c)
+		}
+	}
+}
+
+// RunCleanup runs orphan cleanup now and returns its report. An empty body
+// uses the configured options.
+func (s *Server) RunCleanup(c echo.Context) error {
+	var request data.CleanupRequest
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
+	}
+	opts := s.config.Cleanup
+	if request.DryRun != nil {
+		opts.DryRun = *request.DryRun
+	}
+
+	report, err := s.db.CleanupOrphanedStories(c.Request().Context(), opts)
+	if err != nil {
+		return err
+	}
+	message := "Cleanup finished"
+	if report.Aborted {
+		message = "Cleanup aborted"
+	}
+	return c.JSON(http.StatusOK, map[string]any{"message": message, "report": report})
+}
+
+// GetCleanupReport returns the report of the last orphan cleanup run, whether
+// it was started by the scheduler or an admin.
+func (s *Server) GetCleanupReport(c echo.Context) error {
+	report := s.db.LastCleanupReport()
+	if report == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "No cleanup has run yet")
+	}
+	return c.JSON(http.StatusOK, map[string]any{"message": "Cleanup report found", "report": report})
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/policy"
+)
+
+func (s *Server) CreateChapter(c echo.Context) error {
+	var request data.CreateChapterRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.EditContent) {
+		return forbidden()
+	}
+	chapterId, err := s.db.CreateChapter(c.Request().Context(), storyId, userId, request.Title, request.Content)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, map[string]any{"message": "Chapter created successfully", "chapter_id": chapterId})
+}
+
+func (s *Server) GetChapters(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	chapters, err := s.db.GetChapters(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]any{"message": "Chapters found", "chapters": chapters})
+}
+
+func (s *Server) GetChapter(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	chapterId, err := primitive.ObjectIDFromHex(c.Param("chapter_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid chapter ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	chapter, err := s.db.GetChapter(c.Request().Context(), storyId, chapterId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]any{"message": "Chapter found", "chapter": chapter})
+}
+
+func (s *Server) EditChapter(c echo.Context) error {
+	var request data.EditChapterRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	chapterId, err := primitive.ObjectIDFromHex(request.ChapterID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid chapter ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.EditContent) {
+		return forbidden()
+	}
+	updated, err := s.db.EditChapter(c.Request().Context(), storyId, chapterId, userId, request.Title, request.Content)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return echo.NewHTTPError(http.StatusNotFound, "Chapter not found")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Chapter updated successfully"})
+}
+
+func (s *Server) DeleteChapter(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	chapterId, err := primitive.ObjectIDFromHex(c.Param("chapter_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid chapter ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.EditContent) {
+		return forbidden()
+	}
+	deleted, err := s.db.DeleteChapter(c.Request().Context(), storyId, chapterId, userId)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "Chapter not found")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Chapter deleted successfully"})
+}
+
+func (s *Server) ReorderChapters(c echo.Context) error {
+	var request data.ReorderChaptersRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	chapterIds := make([]primitive.ObjectID, 0, len(request.ChapterIDs))
+	for _, hex := range request.ChapterIDs {
+		chapterId, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid chapter ID")
+		}
+		chapterIds = append(chapterIds, chapterId)
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.EditContent) {
+		return forbidden()
+	}
+	reordered, err := s.db.ReorderChapters(c.Request().Context(), storyId, userId, chapterIds)
+	if err != nil {
+		return err
+	}
+	if !reordered {
+		return echo.NewHTTPError(http.StatusBadRequest, "Chapter list must name every chapter of the story exactly once")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Chapters reordered successfully"})
+}
+
+// rejectChaptered fails with a conflict when the story is split into
+// chapters, whose content can only be changed chapter by chapter.
+func (s *Server) rejectChaptered(c echo.Context, storyID primitive.ObjectID) error {
+	count, err := s.db.CountChapters(c.Request().Context(), storyID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Story is split into chapters, edit its chapters instead")
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/policy"
+)
+
+func (s *Server) InviteCollaborator(c echo.Context) error {
+	var request data.InviteCollaboratorRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	if request.Role == data.RoleNone {
+		request.Role = data.DefaultCollaboratorRole
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	inviteeId, err := primitive.ObjectIDFromHex(request.UserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.ManageCollaborators) {
+		return forbidden()
+	}
+	switch story.RoleOf(inviteeId) {
+	case data.RoleOwner:
+		return echo.NewHTTPError(http.StatusBadRequest, "Cannot invite the story owner")
+	case data.RoleNone:
+	default:
+		return echo.NewHTTPError(http.StatusConflict, "User is already a collaborator")
+	}
+	invited, err := s.db.InviteCollaborator(c.Request().Context(), storyId, inviteeId, request.Role)
+	if err != nil {
+		return err
+	}
+	if !invited {
+		return echo.NewHTTPError(http.StatusConflict, "User has already been invited")
+	}
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Invitation sent successfully"})
+}
+
+func (s *Server) AcceptInvitation(c echo.Context) error {
+	return s.respondToInvitation(c, true)
+}
+
+func (s *Server) DeclineInvitation(c echo.Context) error {
+	return s.respondToInvitation(c, false)
+}
+
+func (s *Server) respondToInvitation(c echo.Context, accept bool) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	responded, err := s.db.RespondToInvitation(c.Request().Context(), storyId, userId, accept)
+	if err != nil {
+		return err
+	}
+	if !responded {
+		return echo.NewHTTPError(http.StatusNotFound, "Invitation not found")
+	}
+	if accept {
+		return c.JSON(http.StatusOK, map[string]string{"message": "Invitation accepted successfully"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Invitation declined successfully"})
+}
+
+func (s *Server) GetInvitations(c echo.Context) error {
+	var request data.PageRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	userId := c.Get("user_id").(primitive.ObjectID)
+	invitations, err := s.db.GetInvitations(c.Request().Context(), userId, request)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pageResponse("Invitations found", "invitations", invitations))
+}
+
+func (s *Server) RemoveCollaborator(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	collaboratorId, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.ManageCollaborators) {
+		return forbidden()
+	}
+	removed, err := s.db.RemoveCollaborator(c.Request().Context(), storyId, collaboratorId)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return echo.NewHTTPError(http.StatusNotFound, "Collaborator not found")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Collaborator removed successfully"})
+}
+
+func (s *Server) LeaveStory(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if story.RoleOf(userId) == data.RoleOwner {
+		return echo.NewHTTPError(http.StatusBadRequest, "The owner cannot leave their own story")
+	}
+	if !policy.Can(story, userId, policy.LeaveStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "You are not a collaborator on this story")
+	}
+	left, err := s.db.RemoveCollaborator(c.Request().Context(), storyId, userId)
+	if err != nil {
+		return err
+	}
+	if !left {
+		return echo.NewHTTPError(http.StatusNotFound, "You are not a collaborator on this story")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Left story successfully"})
+}
+
+func (s *Server) SetCollaboratorRole(c echo.Context) error {
+	var request data.SetCollaboratorRoleRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	collaboratorId, err := primitive.ObjectIDFromHex(request.UserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.ManageCollaborators) {
+		return forbidden()
+	}
+	updated, err := s.db.SetCollaboratorRole(c.Request().Context(), storyId, collaboratorId, request.Role)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return echo.NewHTTPError(http.StatusNotFound, "Collaborator not found")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Collaborator role updated successfully"})
+}
+
+func (s *Server) TransferOwnership(c echo.Context) error {
+	var request data.TransferOwnershipRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	newOwnerId, err := primitive.ObjectIDFromHex(request.UserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.TransferOwnership) {
+		return forbidden()
+	}
+	if newOwnerId == userId {
+		return echo.NewHTTPError(http.StatusBadRequest, "You already own this story")
+	}
+	transferred, err := s.db.TransferOwnership(c.Request().Context(), storyId, newOwnerId)
+	if err != nil {
+		return err
+	}
+	if !transferred {
+		return echo.NewHTTPError(http.StatusBadRequest, "New owner must be a collaborator on the story")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Ownership transferred successfully"})
+}
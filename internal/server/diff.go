@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/diff"
+	"github.com/mAmineChniti/StoryHub/internal/policy"
+)
+
+// currentRevision is the revision reference naming the story's live content.
+const currentRevision = "current"
+
+// errRevisionNotFound answers references that cannot name a revision.
+var errRevisionNotFound = echo.NewHTTPError(http.StatusNotFound, "Revision not found")
+
+func (s *Server) DiffStory(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	from := c.QueryParam("from")
+	if from == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing from revision")
+	}
+	to := c.QueryParam("to")
+	if to == "" {
+		to = currentRevision
+	}
+	granularity := diff.Granularity(c.QueryParam("granularity"))
+	if granularity == "" {
+		granularity = diff.ByLine
+	}
+	if granularity != diff.ByLine && granularity != diff.ByWord {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid granularity")
+	}
+
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+
+	oldText, err := s.revisionText(c.Request().Context(), storyId, from)
+	if err != nil {
+		return err
+	}
+	newText, err := s.revisionText(c.Request().Context(), storyId, to)
+	if err != nil {
+		return err
+	}
+
+	edits := diff.Compute(diff.Split(oldText, granularity), diff.Split(newText, granularity))
+	hunks := diff.Hunks(edits, diff.DefaultContext)
+
+	if c.QueryParam("format") == "text" || strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/x-diff") {
+		c.Response().Header().Set(echo.HeaderContentType, "text/x-diff; charset=utf-8")
+		return c.String(http.StatusOK, diff.Unified(from, to, hunks))
+	}
+
+	if hunks == nil {
+		hunks = []diff.Hunk{}
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"message":     "Diff computed",
+		"story_id":    storyId,
+		"from":        from,
+		"to":          to,
+		"granularity": granularity,
+		"hunks":       hunks,
+	})
+}
+
+// revisionText resolves a revision reference, either a revision ID or
+// currentRevision, to the content it names.
+func (s *Server) revisionText(ctx context.Context, storyID primitive.ObjectID, ref string) (string, error) {
+	if ref == currentRevision {
+		content, err := s.db.GetStoryContent(ctx, storyID)
+		if err != nil {
+			return "", err
+		}
+		return content.Content, nil
+	}
+	revisionID, err := primitive.ObjectIDFromHex(ref)
+	if err != nil {
+		return "", errRevisionNotFound
+	}
+	revision, err := s.db.GetStoryRevision(ctx, storyID, revisionID)
+	if err != nil {
+		return "", err
+	}
+	return revision.Content, nil
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/mAmineChniti/StoryHub/internal/database"
+)
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	// Code is a stable, machine-readable name for the kind of error.
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	RequestID string            `json:"request_id"`
+}
+
+// statusCodes names the statuses handlers answer with. Others fall back to
+// their lower-cased status text.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// databaseErrors maps the kinds of database.Error to their status and code.
+var databaseErrors = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{database.ErrNotFound, http.StatusNotFound, "not_found"},
+	{database.ErrConflict, http.StatusConflict, "conflict"},
+	{database.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{database.ErrValidation, http.StatusBadRequest, "validation_failed"},
+}
+
+// HTTPErrorHandler answers every error a handler or middleware returns with
+// an errorResponse. Errors other than echo.HTTPError and database.Error are
+// logged and reported as internal errors, so that what the database says
+// about them never reaches clients.
+func (s *Server) HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, response := describeError(err)
+	if status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+	response.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, response)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// forbidden is the error for a signed-in caller whose role does not allow
+// what they asked for. A missing or invalid token is a 401 instead.
+func forbidden() error {
+	return &database.Error{Kind: database.ErrForbidden, Message: "you do not have permission to do this"}
+}
+
+func describeError(err error) (int, errorResponse) {
+	var invalid *validationError
+	if errors.As(err, &invalid) {
+		return http.StatusBadRequest, errorResponse{Code: "validation_failed", Message: "Validation failed", Details: invalid.fields}
+	}
+
+	var dbErr *database.Error
+	if errors.As(err, &dbErr) {
+		for _, kind := range databaseErrors {
+			if errors.Is(dbErr.Kind, kind.kind) {
+				return kind.status, errorResponse{Code: kind.code, Message: sentence(dbErr.Message), Details: dbErr.Details}
+			}
+		}
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		message, ok := httpErr.Message.(string)
+		if !ok {
+			message = http.StatusText(httpErr.Code)
+		}
+		return httpErr.Code, errorResponse{Code: statusCode(httpErr.Code), Message: message}
+	}
+
+	return http.StatusInternalServerError, errorResponse{
+		Code:    statusCode(http.StatusInternalServerError),
+		Message: "Internal server error",
+	}
+}
+
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// sentence capitalizes a database error message for clients.
+func sentence(message string) string {
+	if message == "" {
+		return message
+	}
+	return strings.ToUpper(message[:1]) + message[1:]
+}
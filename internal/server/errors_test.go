@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/mAmineChniti/StoryHub/internal/database"
+)
+
+func TestDescribeError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{"http error", echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID"), http.StatusBadRequest, "bad_request", "Invalid story ID"},
+		{"echo sentinel", echo.ErrMethodNotAllowed, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed"},
+		{"not found", &database.Error{Kind: database.ErrNotFound, Message: "story not found"}, http.StatusNotFound, "not_found", "Story not found"},
+		{"wrapped conflict", fmt.Errorf("forking: %w", &database.Error{Kind: database.ErrConflict, Message: "already forked"}), http.StatusConflict, "conflict", "Already forked"},
+		{"invalid body", &validationError{fields: map[string]string{"title": "is required"}}, http.StatusBadRequest, "validation_failed", "Validation failed"},
+		{"invalid cursor", database.ErrInvalidCursor, http.StatusBadRequest, "validation_failed", "Invalid cursor"},
+		{"database failure", errors.New("error fetching story: connection refused"), http.StatusInternalServerError, "internal_error", "Internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, response := describeError(tt.err)
+			if status != tt.wantStatus || response.Code != tt.wantCode || response.Message != tt.wantMessage {
+				t.Errorf("describeError() = %d %q %q, want %d %q %q", status, response.Code, response.Message, tt.wantStatus, tt.wantCode, tt.wantMessage)
+			}
+		})
+	}
+}
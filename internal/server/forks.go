@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/policy"
+)
+
+const (
+	// defaultForkTreeDepth is how many levels of forks a fork tree shows
+	// when the request does not say.
+	defaultForkTreeDepth = 3
+	// maxForkTreeDepth caps the depth a fork tree can be asked for.
+	maxForkTreeDepth = 10
+)
+
+// GetStoryForks lists the listed stories forked directly from a story.
+func (s *Server) GetStoryForks(c echo.Context) error {
+	var request data.StoryForksRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	forks, err := s.db.GetForks(c.Request().Context(), storyId, request.PageRequest)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pageResponse("Forks found", "forks", forks))
+}
+
+// GetStoryAncestors returns the chain of stories a story was forked from,
+// its parent first. The chain stops short of the first ancestor the caller
+// may not see.
+func (s *Server) GetStoryAncestors(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId := callerID(c)
+	if !policy.Can(story, userId, policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	ancestors, err := s.db.GetAncestors(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	for i := range ancestors {
+		if !policy.Can(&ancestors[i], userId, policy.ViewStory) {
+			ancestors = ancestors[:i]
+			break
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]any{"message": "Ancestors found", "ancestors": ancestors})
+}
+
+// GetForkTree returns a story with its listed forks nested below it, down to
+// the depth given in the query, 3 levels by default.
+func (s *Server) GetForkTree(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	depth := defaultForkTreeDepth
+	if value := c.QueryParam("depth"); value != "" {
+		depth, err = strconv.Atoi(value)
+		if err != nil || depth < 1 || depth > maxForkTreeDepth {
+			return echo.NewHTTPError(http.StatusBadRequest, "Depth must be between 1 and "+strconv.Itoa(maxForkTreeDepth))
+		}
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	tree, err := s.db.GetForkTree(c.Request().Context(), storyId, depth)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]any{"message": "Fork tree found", "tree": tree})
+}
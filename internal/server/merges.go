@@ -0,0 +1,257 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/diff"
+	"github.com/mAmineChniti/StoryHub/internal/policy"
+)
+
+// CreateMergeRequest proposes a fork's current content to the story it was
+// forked from. Only the fork's owner can propose it.
+func (s *Server) CreateMergeRequest(c echo.Context) error {
+	var request data.CreateMergeRequestRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	forkId, err := primitive.ObjectIDFromHex(request.ForkID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid fork ID")
+	}
+	fork, err := s.db.GetStoryDetails(c.Request().Context(), forkId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(fork, userId, policy.ProposeMerge) {
+		return forbidden()
+	}
+	if fork.ForkedFrom.IsZero() {
+		return echo.NewHTTPError(http.StatusBadRequest, "Story is not a fork")
+	}
+	upstream, err := s.db.GetStoryDetails(c.Request().Context(), fork.ForkedFrom)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(upstream, userId, policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	if err := s.rejectChaptered(c, upstream.ID); err != nil {
+		return err
+	}
+
+	proposed, err := s.db.GetStoryContent(c.Request().Context(), forkId)
+	if err != nil {
+		return err
+	}
+	current, err := s.db.GetStoryContent(c.Request().Context(), upstream.ID)
+	if err != nil {
+		return err
+	}
+	if proposed.Content == current.Content {
+		return echo.NewHTTPError(http.StatusBadRequest, "Fork has no changes to merge")
+	}
+
+	mergeRequestId, err := s.db.CreateMergeRequest(c.Request().Context(), &data.MergeRequest{
+		StoryID:        upstream.ID,
+		ForkID:         forkId,
+		AuthorID:       userId,
+		Title:          request.Title,
+		Description:    request.Description,
+		Content:        proposed.Content,
+		BaseRevisionID: current.RevisionID,
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, map[string]any{"message": "Merge request created", "merge_request_id": mergeRequestId})
+}
+
+// GetMergeRequests lists the merge requests proposed to a story to anyone
+// who can see the story.
+func (s *Server) GetMergeRequests(c echo.Context) error {
+	var request data.MergeRequestsRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	requests, err := s.db.GetMergeRequests(c.Request().Context(), storyId, request.Status, request.PageRequest)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pageResponse("Merge requests found", "merge_requests", requests))
+}
+
+// GetMergeRequest returns a merge request with its comments and the diff
+// from the upstream story's current content to the proposed content. Its
+// author can still read it after losing access to the upstream story, but
+// the diff then starts from the revision the request was based on, so
+// nothing written upstream since shows through.
+func (s *Server) GetMergeRequest(c echo.Context) error {
+	mergeRequestId, err := primitive.ObjectIDFromHex(c.Param("merge_request_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid merge request ID")
+	}
+	mergeRequest, upstream, err := s.mergeRequest(c, mergeRequestId)
+	if err != nil {
+		return err
+	}
+	userId := callerID(c)
+
+	var base, baseText string
+	switch {
+	case policy.Can(upstream, userId, policy.ViewStory):
+		current, err := s.db.GetStoryContent(c.Request().Context(), upstream.ID)
+		if err != nil {
+			return err
+		}
+		base, baseText = currentRevision, current.Content
+	case userId == mergeRequest.AuthorID:
+		if !mergeRequest.BaseRevisionID.IsZero() {
+			base = mergeRequest.BaseRevisionID.Hex()
+			revision, err := s.db.GetStoryRevision(c.Request().Context(), upstream.ID, mergeRequest.BaseRevisionID)
+			if err != nil {
+				return err
+			}
+			baseText = revision.Content
+		}
+	default:
+		return echo.NewHTTPError(http.StatusNotFound, "Merge request not found")
+	}
+
+	edits := diff.Compute(diff.Split(baseText, diff.ByLine), diff.Split(mergeRequest.Content, diff.ByLine))
+	hunks := diff.Hunks(edits, diff.DefaultContext)
+	if hunks == nil {
+		hunks = []diff.Hunk{}
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"message":       "Merge request found",
+		"merge_request": mergeRequest,
+		"base":          base,
+		"hunks":         hunks,
+	})
+}
+
+// CommentOnMergeRequest adds to a merge request's discussion. Its author
+// can always comment; anyone else needs to be able to comment on the
+// upstream story.
+func (s *Server) CommentOnMergeRequest(c echo.Context) error {
+	var request data.MergeCommentRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	mergeRequestId, err := primitive.ObjectIDFromHex(request.MergeRequestID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid merge request ID")
+	}
+	mergeRequest, upstream, err := s.mergeRequest(c, mergeRequestId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if userId != mergeRequest.AuthorID && !policy.Can(upstream, userId, policy.CommentOnStory) {
+		return forbidden()
+	}
+	commentId, err := s.db.AddMergeComment(c.Request().Context(), mergeRequestId, userId, request.Body)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, map[string]any{"message": "Comment added", "comment_id": commentId})
+}
+
+// AcceptMergeRequest applies a merge request's content to the upstream story
+// as a new revision by the request's author.
+func (s *Server) AcceptMergeRequest(c echo.Context) error {
+	mergeRequestId, err := primitive.ObjectIDFromHex(c.Param("merge_request_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid merge request ID")
+	}
+	_, upstream, err := s.mergeRequest(c, mergeRequestId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(upstream, userId, policy.ReviewMerge) {
+		return forbidden()
+	}
+	if err := s.rejectChaptered(c, upstream.ID); err != nil {
+		return err
+	}
+	revisionId, err := s.db.AcceptMergeRequest(c.Request().Context(), mergeRequestId, userId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]any{"message": "Merge request accepted", "revision_id": revisionId})
+}
+
+func (s *Server) RejectMergeRequest(c echo.Context) error {
+	mergeRequestId, err := primitive.ObjectIDFromHex(c.Param("merge_request_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid merge request ID")
+	}
+	_, upstream, err := s.mergeRequest(c, mergeRequestId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(upstream, userId, policy.ReviewMerge) {
+		return forbidden()
+	}
+	rejected, err := s.db.RejectMergeRequest(c.Request().Context(), mergeRequestId, userId)
+	if err != nil {
+		return err
+	}
+	if !rejected {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to reject merge request")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Merge request rejected"})
+}
+
+// mergeRequest loads a merge request along with the story it is proposed to.
+// Requests to stories that are gone are not found either.
+func (s *Server) mergeRequest(c echo.Context, id primitive.ObjectID) (*data.MergeRequest, *data.StoryDetails, error) {
+	mergeRequest, err := s.db.GetMergeRequest(c.Request().Context(), id)
+	if err != nil {
+		return nil, nil, err
+	}
+	upstream, err := s.db.GetStoryDetails(c.Request().Context(), mergeRequest.StoryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mergeRequest, upstream, nil
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/policy"
+)
+
+// mimeMergePatch is the media type of RFC 7396 JSON Merge Patch documents.
+const mimeMergePatch = "application/merge-patch+json"
+
+// EditStoryMetadata changes a story's title, genre and description with a
+// JSON Merge Patch: fields in the body replace the current ones and fields
+// left out are kept. Setting a field to null removes it, which fails
+// validation since all three are required.
+func (s *Server) EditStoryMetadata(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != mimeMergePatch && mediaType != echo.MIMEApplicationJSON {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Metadata must be sent as "+mimeMergePatch)
+	}
+	var patch map[string]any
+	if err := json.NewDecoder(c.Request().Body).Decode(&patch); err != nil || patch == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !s.canEditMetadata(story, userId) {
+		return forbidden()
+	}
+
+	metadata, err := patchMetadata(story.Metadata(), patch)
+	if err != nil {
+		return err
+	}
+	if err := c.Validate(&metadata); err != nil {
+		return err
+	}
+	updated, err := s.db.UpdateStoryMetadata(c.Request().Context(), storyId, metadata)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	story, err = s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]any{"message": "Story metadata updated successfully", "story": story})
+}
+
+func (s *Server) canEditMetadata(story *data.StoryDetails, userID primitive.ObjectID) bool {
+	if policy.Can(story, userID, policy.EditMetadata) {
+		return true
+	}
+	return s.config.EditorsEditMetadata && policy.Can(story, userID, policy.EditContent)
+}
+
+// patchMetadata applies a merge patch to metadata. Fields that are not part
+// of the metadata, or that are given a value of the wrong type, are reported
+// as a validationError.
+func patchMetadata(metadata data.StoryMetadata, patch map[string]any) (data.StoryMetadata, error) {
+	var document map[string]any
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return metadata, err
+	}
+	if err := json.Unmarshal(encoded, &document); err != nil {
+		return metadata, err
+	}
+
+	fields := make(map[string]string)
+	for name := range patch {
+		if _, ok := document[name]; !ok {
+			fields[name] = "cannot be edited"
+		}
+	}
+	if len(fields) > 0 {
+		return metadata, &validationError{fields: fields}
+	}
+
+	encoded, err = json.Marshal(mergePatch(document, patch))
+	if err != nil {
+		return metadata, err
+	}
+	var patched data.StoryMetadata
+	if err := json.Unmarshal(encoded, &patched); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return metadata, &validationError{fields: map[string]string{typeErr.Field: "must be a " + typeErr.Type.String()}}
+		}
+		return metadata, err
+	}
+	return patched, nil
+}
+
+// mergePatch applies an RFC 7396 JSON Merge Patch to target. Both are values
+// decoded by encoding/json; target may be modified in place.
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// pageResponse renders a page of items under key together with the cursors
+// needed to move to the neighbouring pages.
+func pageResponse[T any](message, key string, page *data.Page[T]) map[string]any {
+	response := map[string]any{
+		"message":     message,
+		key:           page.Items,
+		"next_cursor": page.NextCursor,
+		"prev_cursor": page.PrevCursor,
+	}
+	if page.Total != nil {
+		response["total"] = *page.Total
+	}
+	return response
+}
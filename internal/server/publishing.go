@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/policy"
+)
+
+func (s *Server) PublishStory(c echo.Context) error {
+	var request data.PublishStoryRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.PublishStory) {
+		return forbidden()
+	}
+
+	if request.PublishAt != nil && request.PublishAt.After(s.clock.Now()) {
+		if story.EffectiveStatus() == data.StatusPublished {
+			return echo.NewHTTPError(http.StatusConflict, "Story is already published")
+		}
+		scheduled, err := s.db.ScheduleStory(c.Request().Context(), storyId, *request.PublishAt)
+		if err != nil {
+			return err
+		}
+		if !scheduled {
+			return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+		}
+		return c.JSON(http.StatusOK, map[string]any{"message": "Story scheduled successfully", "publish_at": request.PublishAt})
+	}
+
+	published, err := s.db.PublishStory(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	if !published {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Story published successfully"})
+}
+
+func (s *Server) UnpublishStory(c echo.Context) error {
+	var request data.UnpublishStoryRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.PublishStory) {
+		return forbidden()
+	}
+	status := data.StatusDraft
+	if request.Archive {
+		status = data.StatusArchived
+	}
+	unpublished, err := s.db.UnpublishStory(c.Request().Context(), storyId, status)
+	if err != nil {
+		return err
+	}
+	if !unpublished {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	if request.Archive {
+		return c.JSON(http.StatusOK, map[string]string{"message": "Story archived successfully"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Story unpublished successfully"})
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/policy"
+)
+
+func (s *Server) GetStoryRevisions(c echo.Context) error {
+	var request data.StoryRevisionsRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	revisions, err := s.db.GetStoryRevisions(c.Request().Context(), storyId, request.PageRequest)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pageResponse("Revisions found", "revisions", revisions))
+}
+
+func (s *Server) GetStoryRevision(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	revisionId, err := primitive.ObjectIDFromHex(c.Param("revision_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid revision ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	revision, err := s.db.GetStoryRevision(c.Request().Context(), storyId, revisionId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]any{"message": "Revision found", "revision": revision})
+}
+
+func (s *Server) RestoreStoryRevision(c echo.Context) error {
+	var request data.RestoreRevisionRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	revisionId, err := primitive.ObjectIDFromHex(request.RevisionID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid revision ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.EditContent) {
+		return forbidden()
+	}
+	if err := s.rejectChaptered(c, storyId); err != nil {
+		return err
+	}
+	newRevisionId, err := s.db.RestoreStoryRevision(c.Request().Context(), storyId, revisionId, userId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]any{"message": "Revision restored successfully", "revision_id": newRevisionId})
+}
@@ -5,22 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
-	"slices"
-
 	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
 	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/policy"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
 	e := echo.New()
+	e.HTTPErrorHandler = s.HTTPErrorHandler
+	e.Validator = requestValidator{}
+	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 
@@ -32,91 +33,127 @@ func (s *Server) RegisterRoutes() http.Handler {
 		MaxAge:           300,
 	}))
 
-	e.Logger.SetLevel(log.INFO)
+	if s.logger != nil {
+		e.Logger = s.logger
+	} else {
+		e.Logger.SetLevel(log.INFO)
+	}
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Format: "method=${method}, uri=${uri}, status=${status}\n",
 	}))
 
-	DEBUG(e)
+	if s.config.Debug {
+		DEBUG(e)
+	}
 
 	e.GET("/", func(c echo.Context) error {
 		return c.Redirect(http.StatusMovedPermanently, "/api/v1")
 	})
 	e.POST("/api/v1/create-story", s.CreateStory, s.JWTMiddleware())
-	e.GET("/api/v1/get-story-details/:story_id", s.GetStoryDetails)
-	e.GET("/api/v1/get-story-content/:story_id", s.GetStoryContent)
+	e.GET("/api/v1/get-story-details/:story_id", s.GetStoryDetails, s.OptionalJWTMiddleware())
+	e.GET("/api/v1/get-story-content/:story_id", s.GetStoryContent, s.OptionalJWTMiddleware())
 	e.POST("/api/v1/get-stories", s.GetStories)
-	e.GET("/api/v1/get-story-collaborators/:story_id", s.GetStoryCollaborators)
+	e.GET("/api/v1/get-story-collaborators/:story_id", s.GetStoryCollaborators, s.OptionalJWTMiddleware())
 	e.POST("/api/v1/get-stories-by-filters", s.GetStoriesByFilters)
-	e.POST("/api/v1/get-stories-by-user", s.GetStoriesByUser)
+	e.POST("/api/v1/search-stories", s.SearchStories)
+	e.POST("/api/v1/get-stories-by-user", s.GetStoriesByUser, s.OptionalJWTMiddleware())
 	e.POST("/api/v1/collaborations", s.GetCollaborations, s.JWTMiddleware())
+	e.POST("/api/v1/invite-collaborator", s.InviteCollaborator, s.JWTMiddleware())
+	e.POST("/api/v1/accept-invitation/:story_id", s.AcceptInvitation, s.JWTMiddleware())
+	e.POST("/api/v1/decline-invitation/:story_id", s.DeclineInvitation, s.JWTMiddleware())
+	e.POST("/api/v1/invitations", s.GetInvitations, s.JWTMiddleware())
+	e.DELETE("/api/v1/remove-collaborator/:story_id/:user_id", s.RemoveCollaborator, s.JWTMiddleware())
+	e.DELETE("/api/v1/leave-story/:story_id", s.LeaveStory, s.JWTMiddleware())
+	e.POST("/api/v1/set-collaborator-role", s.SetCollaboratorRole, s.JWTMiddleware())
+	e.POST("/api/v1/transfer-ownership", s.TransferOwnership, s.JWTMiddleware())
 	e.PATCH("/api/v1/edit-story", s.EditStory, s.JWTMiddleware())
+	e.PATCH("/api/v1/edit-story-metadata/:story_id", s.EditStoryMetadata, s.JWTMiddleware())
+	e.POST("/api/v1/create-chapter", s.CreateChapter, s.JWTMiddleware())
+	e.GET("/api/v1/get-chapters/:story_id", s.GetChapters, s.OptionalJWTMiddleware())
+	e.GET("/api/v1/get-chapter/:story_id/:chapter_id", s.GetChapter, s.OptionalJWTMiddleware())
+	e.PATCH("/api/v1/edit-chapter", s.EditChapter, s.JWTMiddleware())
+	e.DELETE("/api/v1/delete-chapter/:story_id/:chapter_id", s.DeleteChapter, s.JWTMiddleware())
+	e.PATCH("/api/v1/reorder-chapters", s.ReorderChapters, s.JWTMiddleware())
+	e.POST("/api/v1/get-story-revisions", s.GetStoryRevisions, s.OptionalJWTMiddleware())
+	e.GET("/api/v1/get-story-revision/:story_id/:revision_id", s.GetStoryRevision, s.OptionalJWTMiddleware())
+	e.POST("/api/v1/restore-story-revision", s.RestoreStoryRevision, s.JWTMiddleware())
+	e.GET("/api/v1/diff-story/:story_id", s.DiffStory, s.OptionalJWTMiddleware())
+	e.PATCH("/api/v1/set-story-visibility", s.SetStoryVisibility, s.JWTMiddleware())
+	e.POST("/api/v1/publish-story", s.PublishStory, s.JWTMiddleware())
+	e.POST("/api/v1/unpublish-story", s.UnpublishStory, s.JWTMiddleware())
 	e.GET("/api/v1/fork-story/:story_id", s.ForkStory, s.JWTMiddleware())
+	e.POST("/api/v1/get-story-forks", s.GetStoryForks, s.OptionalJWTMiddleware())
+	e.GET("/api/v1/get-story-ancestors/:story_id", s.GetStoryAncestors, s.OptionalJWTMiddleware())
+	e.GET("/api/v1/get-fork-tree/:story_id", s.GetForkTree, s.OptionalJWTMiddleware())
+	e.POST("/api/v1/create-merge-request", s.CreateMergeRequest, s.JWTMiddleware())
+	e.POST("/api/v1/get-merge-requests", s.GetMergeRequests, s.OptionalJWTMiddleware())
+	e.GET("/api/v1/get-merge-request/:merge_request_id", s.GetMergeRequest, s.OptionalJWTMiddleware())
+	e.POST("/api/v1/comment-merge-request", s.CommentOnMergeRequest, s.JWTMiddleware())
+	e.POST("/api/v1/accept-merge-request/:merge_request_id", s.AcceptMergeRequest, s.JWTMiddleware())
+	e.POST("/api/v1/reject-merge-request/:merge_request_id", s.RejectMergeRequest, s.JWTMiddleware())
 	e.DELETE("/api/v1/delete-story/:story_id", s.DeleteStory, s.JWTMiddleware())
 	e.DELETE("/api/v1/delete-all-stories", s.DeleteAllStories, s.JWTMiddleware())
+	e.POST("/api/v1/trash", s.GetTrash, s.JWTMiddleware())
+	e.POST("/api/v1/restore-story/:story_id", s.RestoreStory, s.JWTMiddleware())
+	e.POST("/api/v1/admin/cleanup", s.RunCleanup, s.JWTMiddleware(), s.AdminMiddleware())
+	e.GET("/api/v1/admin/cleanup", s.GetCleanupReport, s.JWTMiddleware(), s.AdminMiddleware())
 	e.GET("/api/v1/health", s.healthHandler)
 	e.RouteNotFound("/*", func(c echo.Context) error {
-		return c.JSON(http.StatusNotFound, map[string]string{"message": "Not found"})
+		return echo.NewHTTPError(http.StatusNotFound, "Not found")
 	})
 
 	return e
 }
 
-var (
-	debug     = os.Getenv("DEBUG") == "true"
-	jwtSecret = []byte(os.Getenv("JWTSECRET"))
-)
-
 func DEBUG(e *echo.Echo) {
-	if debug {
-		e.Use(middleware.BodyDump(func(c echo.Context, reqBody, resBody []byte) {
-			if len(reqBody) > 0 {
-				var formattedReq any
-				if err := json.Unmarshal(reqBody, &formattedReq); err != nil {
+	e.Use(middleware.BodyDump(func(c echo.Context, reqBody, resBody []byte) {
+		if len(reqBody) > 0 {
+			var formattedReq any
+			if err := json.Unmarshal(reqBody, &formattedReq); err != nil {
+				log.Printf("Request Body (raw): \n%s\n", string(reqBody))
+				c.Logger().Error("Error parsing request body: " + err.Error())
+			} else {
+				reqBodyJson, err := json.MarshalIndent(formattedReq, "", "  ")
+				if err != nil {
 					log.Printf("Request Body (raw): \n%s\n", string(reqBody))
-					c.Logger().Error("Error parsing request body: " + err.Error())
+					c.Logger().Error("Error marshaling request body: " + err.Error())
 				} else {
-					reqBodyJson, err := json.MarshalIndent(formattedReq, "", "  ")
-					if err != nil {
-						log.Printf("Request Body (raw): \n%s\n", string(reqBody))
-						c.Logger().Error("Error marshaling request body: " + err.Error())
-					} else {
-						c.Logger().Debug("Request Body:\n" + string(reqBodyJson))
-					}
+					c.Logger().Debug("Request Body:\n" + string(reqBodyJson))
 				}
 			}
+		}
 
-			if len(resBody) > 0 {
-				var formattedRes any
-				if err := json.Unmarshal(resBody, &formattedRes); err != nil {
+		if len(resBody) > 0 {
+			var formattedRes any
+			if err := json.Unmarshal(resBody, &formattedRes); err != nil {
+				log.Printf("Response Body (raw): \n%s\n", string(resBody))
+				c.Logger().Error("Error parsing response body: " + err.Error())
+			} else {
+				resBodyJson, err := json.MarshalIndent(formattedRes, "", "  ")
+				if err != nil {
 					log.Printf("Response Body (raw): \n%s\n", string(resBody))
-					c.Logger().Error("Error parsing response body: " + err.Error())
+					c.Logger().Error("Error marshaling response body: " + err.Error())
 				} else {
-					resBodyJson, err := json.MarshalIndent(formattedRes, "", "  ")
-					if err != nil {
-						log.Printf("Response Body (raw): \n%s\n", string(resBody))
-						c.Logger().Error("Error marshaling response body: " + err.Error())
-					} else {
-						c.Logger().Debug("Response Body:\n" + string(resBodyJson))
-					}
+					c.Logger().Debug("Response Body:\n" + string(resBodyJson))
 				}
 			}
-		}))
-	}
+		}
+	}))
 }
 
 func (s *Server) CreateStory(c echo.Context) error {
-	var story data.StoryDetails
-	story.OwnerID = c.Get("user_id").(primitive.ObjectID)
-
-	if err := c.Bind(&story); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
+	var request data.CreateStoryRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
 	}
+	story := request.Story(c.Get("user_id").(primitive.ObjectID))
 
-	insertedID, err := s.db.CreateStory(&story)
+	insertedID, err := s.db.CreateStory(c.Request().Context(), story)
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, map[string]any{
@@ -125,179 +162,234 @@ func (s *Server) CreateStory(c echo.Context) error {
 	})
 }
 
+// GetStoryDetails returns a story to anyone who can see it, along with its
+// invitations and roles for its owner.
 func (s *Server) GetStoryDetails(c echo.Context) error {
 	story_id, err := primitive.ObjectIDFromHex(c.Param("story_id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid story ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
 	}
-	story, err := s.db.GetStoryDetails(story_id)
-	if err != nil || story == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"message": "Story not found"})
+	story, err := s.db.GetStoryDetails(c.Request().Context(), story_id)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
 	}
-	return c.JSON(http.StatusOK, map[string]any{"message": "Story found", "story": story})
+	response := map[string]any{"message": "Story found", "story": story}
+	if policy.Can(story, callerID(c), policy.ManageCollaborators) {
+		response["access"] = story.Access()
+	}
+	return c.JSON(http.StatusOK, response)
 }
 
 func (s *Server) GetStoryContent(c echo.Context) error {
 	story_id, err := primitive.ObjectIDFromHex(c.Param("story_id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid story ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), story_id)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
 	}
-	content, err := s.db.GetStoryContent(story_id)
+	content, err := s.db.GetStoryContent(c.Request().Context(), story_id)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"message": "Story content not found"})
+		return err
 	}
 	return c.JSON(http.StatusOK, map[string]any{"message": "Story content found", "content": content})
 }
 
 func (s *Server) GetStories(c echo.Context) error {
-	var request struct {
-		Page  int `json:"page"`
-		Limit int `json:"limit"`
-	}
+	var request data.PageRequest
 	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
-	stories, err := s.db.GetStories(request.Page, request.Limit)
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	stories, err := s.db.GetStories(c.Request().Context(), request)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
-	return c.JSON(http.StatusOK, map[string]any{"message": "Stories found", "stories": stories})
+	return c.JSON(http.StatusOK, pageResponse("Stories found", "stories", stories))
 }
 
+// GetStoryCollaborators lists a story's collaborators to anyone who can see
+// it. Pending invitations and roles are only included for its owner.
 func (s *Server) GetStoryCollaborators(c echo.Context) error {
 	story_id, err := primitive.ObjectIDFromHex(c.Param("story_id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid story ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), story_id)
+	if err != nil {
+		return err
+	}
+	if !policy.Can(story, callerID(c), policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
 	}
 
-	collaborators, err := s.db.GetStoryCollaborators(story_id)
+	collaborators, err := s.db.GetStoryCollaborators(c.Request().Context(), story_id)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]any{"message": "Collaborators found", "collaborators": collaborators})
+	response := map[string]any{"message": "Collaborators found", "collaborators": collaborators}
+	if policy.Can(story, callerID(c), policy.ManageCollaborators) {
+		access := story.Access()
+		response["invitations"], response["roles"] = access.Invitations, access.Roles
+	}
+	return c.JSON(http.StatusOK, response)
 }
 
 func (s *Server) GetStoriesByFilters(c echo.Context) error {
-	var request struct {
-		Genres []string `json:"genres"`
-		Page   int      `json:"page"`
-		Limit  int      `json:"limit"`
-	}
+	var request data.StoriesByFiltersRequest
 	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
-	stories, err := s.db.GetStoriesByFilters(request.Genres, request.Page, request.Limit)
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	stories, err := s.db.GetStoriesByFilters(c.Request().Context(), request.Genres, request.PageRequest)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
-	return c.JSON(http.StatusOK, map[string]any{"message": "Stories found", "stories": stories})
+	return c.JSON(http.StatusOK, pageResponse("Stories found", "stories", stories))
 }
 
 func (s *Server) GetStoriesByUser(c echo.Context) error {
-	var request struct {
-		UserID string `json:"user_id"`
-		Page   int    `json:"page"`
-		Limit  int    `json:"limit"`
-	}
+	var request data.StoriesByUserRequest
 	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
 	}
 	userID, err := primitive.ObjectIDFromHex(request.UserID)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid user ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
 	}
-	stories, err := s.db.GetStoriesByUser(userID, request.Page, request.Limit)
+	stories, err := s.db.GetStoriesByUser(c.Request().Context(), userID, callerID(c) == userID, request.PageRequest)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
-	return c.JSON(http.StatusOK, map[string]any{"message": "Stories found", "stories": stories})
+	return c.JSON(http.StatusOK, pageResponse("Stories found", "stories", stories))
 }
 
 func (s *Server) GetCollaborations(c echo.Context) error {
-	var request struct {
-		Page  int `json:"page"`
-		Limit int `json:"limit"`
-	}
+	var request data.PageRequest
 	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
 	}
 	userID := c.Get("user_id").(primitive.ObjectID)
-	collaborations, err := s.db.GetCollaborations(userID, request.Page, request.Limit)
+	collaborations, err := s.db.GetCollaborations(c.Request().Context(), userID, request)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
-	return c.JSON(http.StatusOK, map[string]any{"message": "Collaborations found", "collaborations": collaborations})
+	return c.JSON(http.StatusOK, pageResponse("Collaborations found", "collaborations", collaborations))
 }
 
 func (s *Server) EditStory(c echo.Context) error {
-	var updatedStory struct {
-		ID      string `json:"story_id"`
-		Content string `json:"content"`
+	var request data.EditStoryRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
-	if err := c.Bind(&updatedStory); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
+	if err := c.Validate(&request); err != nil {
+		return err
 	}
-	storyId, err := primitive.ObjectIDFromHex(updatedStory.ID)
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid story ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
 	}
-	story, err := s.db.GetStoryDetails(storyId)
-	if err != nil || story == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"message": "Story not found"})
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
 	}
 	userId, ok := c.Get("user_id").(primitive.ObjectID)
 	if !ok {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Unauthorized"})
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
 	}
-
-	isAuthorized := false
-	if userId == story.OwnerID {
-		isAuthorized = true
-	} else {
-		if slices.Contains(story.Collaborators, userId) {
-			isAuthorized = true
-		}
+	if !policy.Can(story, userId, policy.EditContent) {
+		return forbidden()
 	}
-	if !isAuthorized {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Unauthorized"})
+	if err := s.rejectChaptered(c, storyId); err != nil {
+		return err
 	}
-	updated, err := s.db.EditStoryContent(storyId, updatedStory.Content)
+	updated, err := s.db.EditStoryContent(c.Request().Context(), storyId, userId, request.Content)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
 	if !updated {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to update story content"})
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update story content")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Story content updated successfully"})
 }
 
+func (s *Server) SetStoryVisibility(c echo.Context) error {
+	var request data.SetVisibilityRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	storyId, err := primitive.ObjectIDFromHex(request.StoryID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	if !policy.Can(story, userId, policy.ChangeVisibility) {
+		return forbidden()
+	}
+	updated, err := s.db.SetStoryVisibility(c.Request().Context(), storyId, request.Visibility)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Story visibility updated successfully"})
+}
+
 func (s *Server) ForkStory(c echo.Context) error {
 	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid story ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
 	}
-	story, err := s.db.GetStoryDetails(storyId)
-	if err != nil || story == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"message": "Story not found"})
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
 	}
 	userId, ok := c.Get("user_id").(primitive.ObjectID)
 	if !ok {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Unauthorized"})
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
 	}
-	if userId == story.OwnerID {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Cannot fork your own story"})
+	if !policy.Can(story, userId, policy.ViewStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found")
 	}
-	forkedStoryID, err := s.db.ForkStory(storyId, userId)
+	if !policy.Can(story, userId, policy.ForkStory) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Cannot fork your own story")
+	}
+	forkedStoryID, err := s.db.ForkStory(c.Request().Context(), storyId, userId)
 	if err != nil {
-		if strings.Contains(err.Error(), "you have already forked this story") {
-			return c.JSON(http.StatusConflict, map[string]string{"message": "You have already forked this story"})
-		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
 	if forkedStoryID == primitive.NilObjectID {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to fork story"})
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fork story")
 	}
 	return c.JSON(http.StatusCreated, map[string]any{"message": "Story forked successfully", "story_id": forkedStoryID})
 }
@@ -305,47 +397,68 @@ func (s *Server) ForkStory(c echo.Context) error {
 func (s *Server) DeleteStory(c echo.Context) error {
 	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid story ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
 	}
-	story, err := s.db.GetStoryDetails(storyId)
-	if err != nil || story == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"message": "Story not found"})
+	story, err := s.db.GetStoryDetails(c.Request().Context(), storyId)
+	if err != nil {
+		return err
 	}
 	userId, ok := c.Get("user_id").(primitive.ObjectID)
 	if !ok {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Unauthorized"})
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
 	}
-	if userId != story.OwnerID {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Unauthorized"})
+	if !policy.Can(story, userId, policy.DeleteStory) {
+		return forbidden()
 	}
-	deleted, err := s.db.DeleteStory(storyId)
+	deleted, err := s.db.DeleteStory(c.Request().Context(), storyId)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
 	if !deleted {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to delete story"})
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete story")
 	}
-	return c.JSON(http.StatusOK, map[string]string{"message": "Story deleted successfully"})
+	return c.JSON(http.StatusOK, map[string]string{"message": "Story moved to trash"})
 }
 
 func (s *Server) DeleteAllStories(c echo.Context) error {
 	userId, ok := c.Get("user_id").(primitive.ObjectID)
 	if !ok {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Unauthorized"})
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
 	}
-	deleted, err := s.db.DeleteAllStoriesByUser(userId)
+	deleted, err := s.db.DeleteAllStoriesByUser(c.Request().Context(), userId)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
 	if !deleted {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to delete stories"})
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete stories")
 	}
-	return c.JSON(http.StatusOK, map[string]string{"message": "Stories deleted successfully"})
+	return c.JSON(http.StatusOK, map[string]string{"message": "Stories moved to trash"})
 }
 
 func (s *Server) JWTMiddleware() echo.MiddlewareFunc {
-	config := echojwt.Config{
-		SigningKey: jwtSecret,
+	return echojwt.WithConfig(s.jwtConfig())
+}
+
+// OptionalJWTMiddleware authenticates the caller when an Authorization header
+// is present and lets anonymous requests through otherwise. A token that is
+// present but invalid is still rejected.
+func (s *Server) OptionalJWTMiddleware() echo.MiddlewareFunc {
+	config := s.jwtConfig()
+	rejectInvalid := config.ErrorHandler
+	config.ContinueOnIgnoredError = true
+	config.ErrorHandler = func(c echo.Context, err error) error {
+		var extractionErr *echojwt.TokenExtractionError
+		if errors.As(err, &extractionErr) {
+			return nil
+		}
+		return rejectInvalid(c, err)
+	}
+	return echojwt.WithConfig(config)
+}
+
+func (s *Server) jwtConfig() echojwt.Config {
+	return echojwt.Config{
+		SigningKey: s.config.JWTSecret,
 		ParseTokenFunc: func(c echo.Context, auth string) (any, error) {
 			tokenString := auth
 			if strings.HasPrefix(auth, "Bearer ") {
@@ -354,7 +467,7 @@ func (s *Server) JWTMiddleware() echo.MiddlewareFunc {
 
 			claims := &jwt.RegisteredClaims{}
 			token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
-				return jwtSecret, nil
+				return s.config.JWTSecret, nil
 			})
 			if err != nil {
 				c.Logger().Errorf("Token parsing error: %v", err)
@@ -379,19 +492,22 @@ func (s *Server) JWTMiddleware() echo.MiddlewareFunc {
 		TokenLookup: "header:Authorization",
 		ErrorHandler: func(c echo.Context, err error) error {
 			c.Logger().Errorf("JWT Error: %v", err)
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"message": fmt.Sprintf("Unauthorized: %v", err.Error()),
-			})
+			return echo.NewHTTPError(http.StatusUnauthorized, fmt.Sprintf("Unauthorized: %v", err.Error()))
 		},
 	}
-	return echojwt.WithConfig(config)
+}
+
+// callerID returns the authenticated user's ID, or primitive.NilObjectID on
+// routes that do not require a token.
+func callerID(c echo.Context) primitive.ObjectID {
+	userID, _ := c.Get("user_id").(primitive.ObjectID)
+	return userID
 }
 
 func (s *Server) healthHandler(c echo.Context) error {
-	health, err := s.db.Health()
+	health, err := s.db.Health(c.Request().Context())
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal server error"})
+		return err
 	}
 	return c.JSON(http.StatusOK, health)
 }
@@ -0,0 +1,975 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/database"
+	"github.com/mAmineChniti/StoryHub/internal/users"
+)
+
+const testSecret = "test-secret"
+
+// testNow is the server's idea of the current time in route tests.
+var testNow = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type fixedClock struct{ now time.Time }
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+// fixture is a server backed by an in-memory database seeded with:
+//   - story: a public story by owner with two revisions, editor and viewer
+//     as collaborators and a pending invitation for invitee
+//   - draft: an unpublished story by owner
+//   - chaptered: a public story by owner split into one chapter
+//
+// Every fixture user exists in the user directory, and admin is the only
+// admin.
+type fixture struct {
+	db      database.Service
+	handler http.Handler
+
+	users     map[string]primitive.ObjectID
+	story     primitive.ObjectID
+	draft     primitive.ObjectID
+	chaptered primitive.ObjectID
+	chapter   primitive.ObjectID
+	revision  primitive.ObjectID
+	// orphans are stories seeded by withOrphans.
+	orphans []primitive.ObjectID
+	// fork is the fork of story seeded by withFork.
+	fork primitive.ObjectID
+	// mergeRequest is the merge request from fork seeded by
+	// withMergeRequest.
+	mergeRequest primitive.ObjectID
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	f := &fixture{users: make(map[string]primitive.ObjectID)}
+	var existing []primitive.ObjectID
+	for _, name := range []string{"owner", "editor", "viewer", "invitee", "stranger", "admin"} {
+		f.users[name] = primitive.NewObjectID()
+		existing = append(existing, f.users[name])
+	}
+	owner := f.users["owner"]
+
+	db := database.NewMemory(users.NewStaticDirectory(existing...))
+	config := Config{
+		JWTSecret:      []byte(testSecret),
+		Admins:         []primitive.ObjectID{f.users["admin"]},
+		Cleanup:        database.CleanupOptions{MaxOrphanedShare: 0.5},
+		TrashRetention: time.Hour,
+	}
+	_, f.handler = New(config, db, fixedClock{testNow}, nil)
+	f.db = db
+
+	var err error
+	f.story, err = db.CreateStory(t.Context(), &data.StoryDetails{Title: "Dragon Road", Genre: "fantasy", Description: "A long journey", OwnerID: owner})
+	mustSeed(t, err)
+	_, err = db.EditStoryContent(t.Context(), f.story, owner, "Once upon a time.")
+	mustSeed(t, err)
+	revisions, err := db.GetStoryRevisions(t.Context(), f.story, data.PageRequest{})
+	mustSeed(t, err)
+	f.revision = revisions.Items[0].ID
+	_, err = db.EditStoryContent(t.Context(), f.story, owner, "Once upon a time there was a dragon.")
+	mustSeed(t, err)
+	for name, role := range map[string]data.Role{"editor": data.RoleEditor, "viewer": data.RoleViewer} {
+		_, err = db.InviteCollaborator(t.Context(), f.story, f.users[name], role)
+		mustSeed(t, err)
+		_, err = db.RespondToInvitation(t.Context(), f.story, f.users[name], true)
+		mustSeed(t, err)
+	}
+	_, err = db.InviteCollaborator(t.Context(), f.story, f.users["invitee"], data.RoleEditor)
+	mustSeed(t, err)
+
+	f.draft, err = db.CreateStory(t.Context(), &data.StoryDetails{Title: "Unfinished", Genre: "fantasy", OwnerID: owner, Status: data.StatusDraft})
+	mustSeed(t, err)
+
+	f.chaptered, err = db.CreateStory(t.Context(), &data.StoryDetails{Title: "Sea Tales", Genre: "adventure", OwnerID: owner})
+	mustSeed(t, err)
+	f.chapter, err = db.CreateChapter(t.Context(), f.chaptered, owner, "Harbor", "The ship left at dawn.")
+	mustSeed(t, err)
+
+	return f
+}
+
+// withOrphans seeds n stories owned by users the directory reports as
+// deleted, and invites the first of those users to story.
+func withOrphans(n int) func(t *testing.T, f *fixture) {
+	return func(t *testing.T, f *fixture) {
+		for i := range n {
+			ghost := primitive.NewObjectID()
+			id, err := f.db.CreateStory(t.Context(), &data.StoryDetails{Title: "Abandoned", Genre: "drama", OwnerID: ghost})
+			mustSeed(t, err)
+			f.orphans = append(f.orphans, id)
+			if i == 0 {
+				_, err = f.db.InviteCollaborator(t.Context(), f.story, ghost, data.RoleViewer)
+				mustSeed(t, err)
+			}
+		}
+	}
+}
+
+// withFork seeds a fork of story by stranger.
+func withFork(t *testing.T, f *fixture) {
+	var err error
+	f.fork, err = f.db.ForkStory(t.Context(), f.story, f.users["stranger"])
+	mustSeed(t, err)
+}
+
+// withForkChain seeds a fork of story by stranger and a fork of that by
+// invitee.
+func withForkChain(t *testing.T, f *fixture) {
+	withFork(t, f)
+	_, err := f.db.ForkStory(t.Context(), f.fork, f.users["invitee"])
+	mustSeed(t, err)
+}
+
+// trashed runs setup and then deletes the story it names.
+func trashed(setup func(t *testing.T, f *fixture), story func(f *fixture) primitive.ObjectID) func(t *testing.T, f *fixture) {
+	return func(t *testing.T, f *fixture) {
+		if setup != nil {
+			setup(t, f)
+		}
+		_, err := f.db.DeleteStory(t.Context(), story(f))
+		mustSeed(t, err)
+	}
+}
+
+// mergedContent is what the merge request seeded by withMergeRequest
+// proposes for story.
+const mergedContent = "Once upon a time there was a dragon.\nIt breathed fire."
+
+// withMergeRequest seeds a fork of story by stranger that changes its
+// content, and an open merge request from it.
+func withMergeRequest(t *testing.T, f *fixture) {
+	withFork(t, f)
+	_, err := f.db.EditStoryContent(t.Context(), f.fork, f.users["stranger"], mergedContent)
+	mustSeed(t, err)
+	base, err := f.db.GetStoryContent(t.Context(), f.story)
+	mustSeed(t, err)
+	f.mergeRequest, err = f.db.CreateMergeRequest(t.Context(), &data.MergeRequest{
+		StoryID:        f.story,
+		ForkID:         f.fork,
+		AuthorID:       f.users["stranger"],
+		Title:          "Add fire",
+		Content:        mergedContent,
+		BaseRevisionID: base.RevisionID,
+	})
+	mustSeed(t, err)
+}
+
+func theStory(f *fixture) primitive.ObjectID { return f.story }
+func theFork(f *fixture) primitive.ObjectID  { return f.fork }
+
+func mustSeed(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("seeding fixture: %v", err)
+	}
+}
+
+// expand replaces the {placeholders} used by route tests with fixture IDs.
+func (f *fixture) expand(s string) string {
+	pairs := []string{
+		"{story}", f.story.Hex(),
+		"{draft}", f.draft.Hex(),
+		"{chaptered}", f.chaptered.Hex(),
+		"{chapter}", f.chapter.Hex(),
+		"{revision}", f.revision.Hex(),
+		"{fork}", f.fork.Hex(),
+		"{merge}", f.mergeRequest.Hex(),
+		"{missing}", primitive.NewObjectID().Hex(),
+	}
+	for name, id := range f.users {
+		pairs = append(pairs, "{"+name+"}", id.Hex())
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+func mintToken(t *testing.T, userID primitive.ObjectID, tokenType string) string {
+	t.Helper()
+	now := time.Now()
+	claims := &jwt.RegisteredClaims{
+		Subject:   userID.Hex(),
+		ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        tokenType,
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return token
+}
+
+type routeTest struct {
+	name   string
+	method string
+	path   string
+	body   string
+	// as names the fixture user the request is authenticated as. "" sends
+	// no token, "forged" a token signed with the wrong secret and "refresh"
+	// a refresh token for owner.
+	as          string
+	setup       func(t *testing.T, f *fixture)
+	wantStatus  int
+	wantMessage string
+	check       func(t *testing.T, f *fixture, body map[string]any)
+}
+
+func (tt routeTest) run(t *testing.T) {
+	f := newFixture(t)
+	if tt.setup != nil {
+		tt.setup(t, f)
+	}
+
+	var body *strings.Reader
+	if tt.body != "" {
+		body = strings.NewReader(f.expand(tt.body))
+	} else {
+		body = strings.NewReader("")
+	}
+	req := httptest.NewRequest(tt.method, f.expand(tt.path), body)
+	if tt.body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	switch tt.as {
+	case "":
+	case "forged":
+		forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: f.users["owner"].Hex(), ID: "access"}).SignedString([]byte("wrong-secret"))
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+forged)
+	case "refresh":
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+mintToken(t, f.users["owner"], "refresh"))
+	default:
+		userID, ok := f.users[tt.as]
+		if !ok {
+			t.Fatalf("unknown user %q", tt.as)
+		}
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+mintToken(t, userID, "access"))
+	}
+
+	rec := httptest.NewRecorder()
+	f.handler.ServeHTTP(rec, req)
+
+	if rec.Code != tt.wantStatus {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body.String())
+	}
+
+	var decoded map[string]any
+	if strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("decoding body %q: %v", rec.Body.String(), err)
+		}
+	}
+	if rec.Code >= http.StatusBadRequest {
+		requestID := rec.Header().Get(echo.HeaderXRequestID)
+		if decoded["code"] == nil || decoded["code"] == "" || decoded["message"] == nil || decoded["request_id"] != requestID {
+			t.Errorf("error body %s does not match the envelope for request %q", rec.Body.String(), requestID)
+		}
+	}
+	if tt.wantMessage != "" && decoded["message"] != tt.wantMessage {
+		t.Errorf("message = %v, want %q", decoded["message"], tt.wantMessage)
+	}
+	if tt.check != nil {
+		tt.check(t, f, decoded)
+	}
+}
+
+// itemCount returns the length of the JSON array under key.
+func itemCount(t *testing.T, body map[string]any, key string) int {
+	t.Helper()
+	items, ok := body[key].([]any)
+	if !ok && body[key] != nil {
+		t.Fatalf("%s is %T, want an array", key, body[key])
+	}
+	return len(items)
+}
+
+func wantCount(key string, want int) func(t *testing.T, f *fixture, body map[string]any) {
+	return func(t *testing.T, f *fixture, body map[string]any) {
+		if got := itemCount(t, body, key); got != want {
+			t.Errorf("len(%s) = %d, want %d", key, got, want)
+		}
+	}
+}
+
+// wantInvalid checks that a validation failure names each of fields.
+func wantInvalid(fields ...string) func(t *testing.T, f *fixture, body map[string]any) {
+	return func(t *testing.T, f *fixture, body map[string]any) {
+		details, _ := body["details"].(map[string]any)
+		for _, field := range fields {
+			if _, ok := details[field]; !ok {
+				t.Errorf("details = %v, want an entry for %s", body["details"], field)
+			}
+		}
+	}
+}
+
+func storyOf(t *testing.T, f *fixture, id primitive.ObjectID) *data.StoryDetails {
+	t.Helper()
+	story, err := f.db.GetStoryDetails(t.Context(), id)
+	if err != nil {
+		t.Fatalf("fetching story: %v", err)
+	}
+	return story
+}
+
+func contentOf(t *testing.T, f *fixture, id primitive.ObjectID) string {
+	t.Helper()
+	content, err := f.db.GetStoryContent(t.Context(), id)
+	if err != nil {
+		t.Fatalf("fetching content: %v", err)
+	}
+	return content.Content
+}
+
+var routeTests = []routeTest{
+	// Stories
+	{name: "create story", method: http.MethodPost, path: "/api/v1/create-story", body: `{"title":"New","genre":"drama","description":"A story about something new."}`, as: "stranger", wantStatus: http.StatusCreated, wantMessage: "Story created successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			id, _ := primitive.ObjectIDFromHex(body["story_id"].(string))
+			if story := storyOf(t, f, id); story.OwnerID != f.users["stranger"] {
+				t.Errorf("owner = %s, want the caller", story.OwnerID.Hex())
+			}
+		}},
+	{name: "create story anonymously", method: http.MethodPost, path: "/api/v1/create-story", body: `{"title":"New"}`, wantStatus: http.StatusUnauthorized},
+	{name: "create story with forged token", method: http.MethodPost, path: "/api/v1/create-story", body: `{"title":"New"}`, as: "forged", wantStatus: http.StatusUnauthorized},
+	{name: "create story with refresh token", method: http.MethodPost, path: "/api/v1/create-story", body: `{"title":"New"}`, as: "refresh", wantStatus: http.StatusUnauthorized},
+	{name: "create story with invalid visibility", method: http.MethodPost, path: "/api/v1/create-story", body: `{"title":"New","genre":"drama","description":"A story about something new.","visibility":"secret"}`, as: "owner", wantStatus: http.StatusBadRequest, wantMessage: "Validation failed", check: wantInvalid("visibility")},
+	{name: "create story without title", method: http.MethodPost, path: "/api/v1/create-story", body: `{"genre":"drama","description":"A story about something new."}`, as: "owner", wantStatus: http.StatusBadRequest, wantMessage: "Validation failed", check: wantInvalid("title")},
+	{name: "create story ignores server fields", method: http.MethodPost, path: "/api/v1/create-story", body: `{"title":"New","genre":"drama","description":"A story about something new.","owner_id":"{owner}","collaborators":["{editor}"],"forked_from":"{story}"}`, as: "stranger", wantStatus: http.StatusCreated,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			id, _ := primitive.ObjectIDFromHex(body["story_id"].(string))
+			story := storyOf(t, f, id)
+			if story.OwnerID != f.users["stranger"] || len(story.Collaborators) != 0 || !story.ForkedFrom.IsZero() {
+				t.Errorf("story = %+v, want server fields left alone", story)
+			}
+		}},
+
+	{name: "get public story details", method: http.MethodGet, path: "/api/v1/get-story-details/{story}", wantStatus: http.StatusOK, wantMessage: "Story found",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			story := body["story"].(map[string]any)
+			if title := story["title"]; title != "Dragon Road" {
+				t.Errorf("title = %v", title)
+			}
+			if _, ok := body["access"]; ok || story["invitations"] != nil || story["roles"] != nil {
+				t.Errorf("invitations and roles shown to an anonymous caller: %v", body)
+			}
+		}},
+	{name: "get story details as owner", method: http.MethodGet, path: "/api/v1/get-story-details/{story}", as: "owner", wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			access, _ := body["access"].(map[string]any)
+			roles, _ := access["roles"].(map[string]any)
+			if itemCount(t, access, "invitations") != 1 || len(roles) == 0 {
+				t.Errorf("unexpected access: %v", body)
+			}
+		}},
+	{name: "get draft details anonymously", method: http.MethodGet, path: "/api/v1/get-story-details/{draft}", wantStatus: http.StatusNotFound, wantMessage: "Story not found"},
+	{name: "get draft details as stranger", method: http.MethodGet, path: "/api/v1/get-story-details/{draft}", as: "stranger", wantStatus: http.StatusNotFound},
+	{name: "get draft details as owner", method: http.MethodGet, path: "/api/v1/get-story-details/{draft}", as: "owner", wantStatus: http.StatusOK},
+	{name: "get story details with forged token", method: http.MethodGet, path: "/api/v1/get-story-details/{story}", as: "forged", wantStatus: http.StatusUnauthorized},
+	{name: "get story details with invalid ID", method: http.MethodGet, path: "/api/v1/get-story-details/nope", wantStatus: http.StatusBadRequest, wantMessage: "Invalid story ID"},
+	{name: "get missing story details", method: http.MethodGet, path: "/api/v1/get-story-details/{missing}", wantStatus: http.StatusNotFound},
+
+	{name: "get story content", method: http.MethodGet, path: "/api/v1/get-story-content/{story}", wantStatus: http.StatusOK, wantMessage: "Story content found",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if content := body["content"].(map[string]any)["content"]; content != "Once upon a time there was a dragon." {
+				t.Errorf("content = %v", content)
+			}
+		}},
+	{name: "get draft content anonymously", method: http.MethodGet, path: "/api/v1/get-story-content/{draft}", wantStatus: http.StatusNotFound},
+
+	{name: "get stories", method: http.MethodPost, path: "/api/v1/get-stories", body: `{}`, wantStatus: http.StatusOK, wantMessage: "Stories found", check: wantCount("stories", 2)},
+	{name: "get stories paged", method: http.MethodPost, path: "/api/v1/get-stories", body: `{"limit":1,"with_total":true}`, wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if itemCount(t, body, "stories") != 1 || body["next_cursor"] == "" || body["total"] != float64(2) {
+				t.Errorf("unexpected page: %v", body)
+			}
+		}},
+	{name: "get stories with invalid sort", method: http.MethodPost, path: "/api/v1/get-stories", body: `{"sort":"random"}`, wantStatus: http.StatusBadRequest, wantMessage: "Validation failed", check: wantInvalid("sort")},
+	{name: "get stories with invalid cursor", method: http.MethodPost, path: "/api/v1/get-stories", body: `{"cursor":"garbage"}`, wantStatus: http.StatusBadRequest, wantMessage: "Invalid cursor"},
+
+	{name: "get story collaborators", method: http.MethodGet, path: "/api/v1/get-story-collaborators/{story}", wantStatus: http.StatusOK, wantMessage: "Collaborators found",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if _, ok := body["invitations"]; ok || itemCount(t, body, "collaborators") != 2 {
+				t.Errorf("unexpected collaborators: %v", body)
+			}
+			if _, ok := body["roles"]; ok {
+				t.Errorf("roles shown to an anonymous caller: %v", body)
+			}
+		}},
+	{name: "get story collaborators as owner", method: http.MethodGet, path: "/api/v1/get-story-collaborators/{story}", as: "owner", wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if itemCount(t, body, "collaborators") != 2 || itemCount(t, body, "invitations") != 1 || body["roles"] == nil {
+				t.Errorf("unexpected collaborators: %v", body)
+			}
+		}},
+	{name: "get story collaborators as editor", method: http.MethodGet, path: "/api/v1/get-story-collaborators/{story}", as: "editor", wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if _, ok := body["invitations"]; ok {
+				t.Errorf("invitations shown to an editor: %v", body)
+			}
+		}},
+	{name: "get draft collaborators anonymously", method: http.MethodGet, path: "/api/v1/get-story-collaborators/{draft}", wantStatus: http.StatusNotFound},
+
+	{name: "get stories by filters", method: http.MethodPost, path: "/api/v1/get-stories-by-filters", body: `{"genres":["adventure"]}`, wantStatus: http.StatusOK, check: wantCount("stories", 1)},
+	{name: "get stories by filters hides drafts", method: http.MethodPost, path: "/api/v1/get-stories-by-filters", body: `{"genres":["fantasy"]}`, wantStatus: http.StatusOK, check: wantCount("stories", 1)},
+
+	{name: "search stories", method: http.MethodPost, path: "/api/v1/search-stories", body: `{"query":"dragon","with_total":true}`, wantStatus: http.StatusOK, wantMessage: "Stories found",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if body["total"] != float64(1) || itemCount(t, body, "results") != 1 || body["next_cursor"] != "" {
+				t.Errorf("unexpected results: %v", body)
+			}
+		}},
+	{name: "search stories paged", method: http.MethodPost, path: "/api/v1/search-stories", body: `{"query":"dragon","limit":1,"with_total":true}`, setup: withFork, wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if itemCount(t, body, "results") != 1 || body["next_cursor"] == "" || body["prev_cursor"] != "" || body["total"] != float64(2) {
+				t.Errorf("unexpected page: %v", body)
+			}
+		}},
+	{name: "search stories sorted", method: http.MethodPost, path: "/api/v1/search-stories", body: `{"query":"dragon","sort":"title"}`, wantStatus: http.StatusBadRequest, wantMessage: "Validation failed", check: wantInvalid("sort")},
+	{name: "search stories with invalid cursor", method: http.MethodPost, path: "/api/v1/search-stories", body: `{"query":"dragon","cursor":"garbage"}`, wantStatus: http.StatusBadRequest, wantMessage: "Invalid cursor"},
+	{name: "search stories without query", method: http.MethodPost, path: "/api/v1/search-stories", body: `{"query":"  "}`, wantStatus: http.StatusBadRequest, wantMessage: "Validation failed", check: wantInvalid("query")},
+
+	{name: "get stories by user anonymously", method: http.MethodPost, path: "/api/v1/get-stories-by-user", body: `{"user_id":"{owner}"}`, wantStatus: http.StatusOK, check: wantCount("stories", 2)},
+	{name: "get own stories includes drafts", method: http.MethodPost, path: "/api/v1/get-stories-by-user", body: `{"user_id":"{owner}"}`, as: "owner", wantStatus: http.StatusOK, check: wantCount("stories", 3)},
+	{name: "get stories by invalid user", method: http.MethodPost, path: "/api/v1/get-stories-by-user", body: `{"user_id":"nope"}`, wantStatus: http.StatusBadRequest, wantMessage: "Validation failed", check: wantInvalid("user_id")},
+
+	{name: "get collaborations", method: http.MethodPost, path: "/api/v1/collaborations", body: `{}`, as: "editor", wantStatus: http.StatusOK, wantMessage: "Collaborations found", check: wantCount("collaborations", 1)},
+	{name: "get collaborations anonymously", method: http.MethodPost, path: "/api/v1/collaborations", body: `{}`, wantStatus: http.StatusUnauthorized},
+
+	// Collaborators
+	{name: "invite collaborator", method: http.MethodPost, path: "/api/v1/invite-collaborator", body: `{"story_id":"{story}","user_id":"{stranger}","role":"viewer"}`, as: "owner", wantStatus: http.StatusCreated, wantMessage: "Invitation sent successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if story := storyOf(t, f, f.story); story.Roles[f.users["stranger"].Hex()] != data.RoleViewer {
+				t.Errorf("roles = %v", story.Roles)
+			}
+		}},
+	{name: "invite collaborator as editor", method: http.MethodPost, path: "/api/v1/invite-collaborator", body: `{"story_id":"{story}","user_id":"{stranger}"}`, as: "editor", wantStatus: http.StatusForbidden},
+	{name: "invite the owner", method: http.MethodPost, path: "/api/v1/invite-collaborator", body: `{"story_id":"{story}","user_id":"{owner}"}`, as: "owner", wantStatus: http.StatusBadRequest, wantMessage: "Cannot invite the story owner"},
+	{name: "invite an existing collaborator", method: http.MethodPost, path: "/api/v1/invite-collaborator", body: `{"story_id":"{story}","user_id":"{editor}"}`, as: "owner", wantStatus: http.StatusConflict, wantMessage: "User is already a collaborator"},
+	{name: "invite twice", method: http.MethodPost, path: "/api/v1/invite-collaborator", body: `{"story_id":"{story}","user_id":"{invitee}"}`, as: "owner", wantStatus: http.StatusConflict, wantMessage: "User has already been invited"},
+	{name: "invite with invalid role", method: http.MethodPost, path: "/api/v1/invite-collaborator", body: `{"story_id":"{story}","user_id":"{stranger}","role":"owner"}`, as: "owner", wantStatus: http.StatusBadRequest, wantMessage: "Validation failed", check: wantInvalid("role")},
+
+	{name: "accept invitation", method: http.MethodPost, path: "/api/v1/accept-invitation/{story}", as: "invitee", wantStatus: http.StatusOK, wantMessage: "Invitation accepted successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if role := storyOf(t, f, f.story).RoleOf(f.users["invitee"]); role != data.RoleEditor {
+				t.Errorf("role = %q, want editor", role)
+			}
+		}},
+	{name: "accept invitation to trashed story", method: http.MethodPost, path: "/api/v1/accept-invitation/{story}", as: "invitee", setup: trashed(nil, func(f *fixture) primitive.ObjectID { return f.story }), wantStatus: http.StatusNotFound, wantMessage: "Invitation not found",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			story, err := f.db.GetTrashedStory(t.Context(), f.story, time.Hour)
+			if err != nil {
+				t.Fatalf("fetching trashed story: %v", err)
+			}
+			if slices.Contains(story.Collaborators, f.users["invitee"]) {
+				t.Error("invitee joined a trashed story")
+			}
+		}},
+	{name: "accept missing invitation", method: http.MethodPost, path: "/api/v1/accept-invitation/{story}", as: "stranger", wantStatus: http.StatusNotFound, wantMessage: "Invitation not found"},
+	{name: "decline invitation", method: http.MethodPost, path: "/api/v1/decline-invitation/{story}", as: "invitee", wantStatus: http.StatusOK, wantMessage: "Invitation declined successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if role := storyOf(t, f, f.story).RoleOf(f.users["invitee"]); role != data.RoleNone {
+				t.Errorf("role = %q, want none", role)
+			}
+		}},
+	{name: "get invitations", method: http.MethodPost, path: "/api/v1/invitations", body: `{}`, as: "invitee", wantStatus: http.StatusOK, wantMessage: "Invitations found", check: wantCount("invitations", 1)},
+
+	{name: "remove collaborator", method: http.MethodDelete, path: "/api/v1/remove-collaborator/{story}/{editor}", as: "owner", wantStatus: http.StatusOK, wantMessage: "Collaborator removed successfully"},
+	{name: "remove collaborator as editor", method: http.MethodDelete, path: "/api/v1/remove-collaborator/{story}/{viewer}", as: "editor", wantStatus: http.StatusForbidden},
+	{name: "remove a non-collaborator", method: http.MethodDelete, path: "/api/v1/remove-collaborator/{story}/{stranger}", as: "owner", wantStatus: http.StatusNotFound, wantMessage: "Collaborator not found"},
+
+	{name: "leave story", method: http.MethodDelete, path: "/api/v1/leave-story/{story}", as: "editor", wantStatus: http.StatusOK, wantMessage: "Left story successfully"},
+	{name: "leave own story", method: http.MethodDelete, path: "/api/v1/leave-story/{story}", as: "owner", wantStatus: http.StatusBadRequest},
+	{name: "leave story as stranger", method: http.MethodDelete, path: "/api/v1/leave-story/{story}", as: "stranger", wantStatus: http.StatusNotFound},
+
+	{name: "set collaborator role", method: http.MethodPost, path: "/api/v1/set-collaborator-role", body: `{"story_id":"{story}","user_id":"{editor}","role":"commenter"}`, as: "owner", wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if role := storyOf(t, f, f.story).RoleOf(f.users["editor"]); role != data.RoleCommenter {
+				t.Errorf("role = %q, want commenter", role)
+			}
+		}},
+	{name: "set collaborator role as editor", method: http.MethodPost, path: "/api/v1/set-collaborator-role", body: `{"story_id":"{story}","user_id":"{viewer}","role":"editor"}`, as: "editor", wantStatus: http.StatusForbidden},
+	{name: "set role of a non-collaborator", method: http.MethodPost, path: "/api/v1/set-collaborator-role", body: `{"story_id":"{story}","user_id":"{stranger}","role":"editor"}`, as: "owner", wantStatus: http.StatusNotFound},
+
+	{name: "transfer ownership", method: http.MethodPost, path: "/api/v1/transfer-ownership", body: `{"story_id":"{story}","user_id":"{editor}"}`, as: "owner", wantStatus: http.StatusOK, wantMessage: "Ownership transferred successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			story := storyOf(t, f, f.story)
+			if story.OwnerID != f.users["editor"] || story.RoleOf(f.users["owner"]) != data.RoleEditor {
+				t.Errorf("owner = %s, previous owner role = %q", story.OwnerID.Hex(), story.RoleOf(f.users["owner"]))
+			}
+		}},
+	{name: "transfer ownership as editor", method: http.MethodPost, path: "/api/v1/transfer-ownership", body: `{"story_id":"{story}","user_id":"{editor}"}`, as: "editor", wantStatus: http.StatusForbidden},
+	{name: "transfer ownership to a stranger", method: http.MethodPost, path: "/api/v1/transfer-ownership", body: `{"story_id":"{story}","user_id":"{stranger}"}`, as: "owner", wantStatus: http.StatusBadRequest},
+
+	// Content and chapters
+	{name: "edit story as collaborator", method: http.MethodPatch, path: "/api/v1/edit-story", body: `{"story_id":"{story}","content":"Rewritten from the start."}`, as: "editor", wantStatus: http.StatusOK, wantMessage: "Story content updated successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if content := contentOf(t, f, f.story); content != "Rewritten from the start." {
+				t.Errorf("content = %q", content)
+			}
+		}},
+	{name: "edit story with short content", method: http.MethodPatch, path: "/api/v1/edit-story", body: `{"story_id":"{story}","content":"Short."}`, as: "owner", wantStatus: http.StatusBadRequest, check: wantInvalid("content")},
+	{name: "edit story as viewer", method: http.MethodPatch, path: "/api/v1/edit-story", body: `{"story_id":"{story}","content":"Rewritten from the start."}`, as: "viewer", wantStatus: http.StatusForbidden},
+	{name: "edit story as stranger", method: http.MethodPatch, path: "/api/v1/edit-story", body: `{"story_id":"{story}","content":"Rewritten from the start."}`, as: "stranger", wantStatus: http.StatusForbidden},
+	{name: "edit chaptered story", method: http.MethodPatch, path: "/api/v1/edit-story", body: `{"story_id":"{chaptered}","content":"Rewritten from the start."}`, as: "owner", wantStatus: http.StatusConflict},
+	{name: "edit missing story", method: http.MethodPatch, path: "/api/v1/edit-story", body: `{"story_id":"{missing}","content":"Rewritten from the start."}`, as: "owner", wantStatus: http.StatusNotFound},
+
+	{name: "edit story metadata", method: http.MethodPatch, path: "/api/v1/edit-story-metadata/{story}", body: `{"title":"Dragon Highway"}`, as: "owner", wantStatus: http.StatusOK, wantMessage: "Story metadata updated successfully",
+		// Stored times keep milliseconds, so let one pass for the update to show.
+		setup: func(t *testing.T, f *fixture) { time.Sleep(2 * time.Millisecond) },
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			story := storyOf(t, f, f.story)
+			if story.Title != "Dragon Highway" || story.Genre != "fantasy" || story.Description != "A long journey" {
+				t.Errorf("metadata = %+v, want only the title changed", story.Metadata())
+			}
+			if !story.UpdatedAt.After(story.CreatedAt) {
+				t.Errorf("updated_at = %v, want it bumped past %v", story.UpdatedAt, story.CreatedAt)
+			}
+		}},
+	{name: "edit story metadata as editor", method: http.MethodPatch, path: "/api/v1/edit-story-metadata/{story}", body: `{"title":"Dragon Highway"}`, as: "editor", wantStatus: http.StatusForbidden},
+	{name: "edit story metadata as editor when allowed", method: http.MethodPatch, path: "/api/v1/edit-story-metadata/{story}", body: `{"genre":"adventure"}`, as: "editor", wantStatus: http.StatusOK,
+		setup: func(t *testing.T, f *fixture) {
+			_, f.handler = New(Config{JWTSecret: []byte(testSecret), EditorsEditMetadata: true}, f.db, fixedClock{testNow}, nil)
+		}},
+	{name: "edit story metadata as viewer when editors are allowed", method: http.MethodPatch, path: "/api/v1/edit-story-metadata/{story}", body: `{"genre":"adventure"}`, as: "viewer", wantStatus: http.StatusForbidden,
+		setup: func(t *testing.T, f *fixture) {
+			_, f.handler = New(Config{JWTSecret: []byte(testSecret), EditorsEditMetadata: true}, f.db, fixedClock{testNow}, nil)
+		}},
+	{name: "remove story title", method: http.MethodPatch, path: "/api/v1/edit-story-metadata/{story}", body: `{"title":null}`, as: "owner", wantStatus: http.StatusBadRequest, check: wantInvalid("title")},
+	{name: "edit story owner through metadata", method: http.MethodPatch, path: "/api/v1/edit-story-metadata/{story}", body: `{"owner_id":"{stranger}"}`, as: "owner", wantStatus: http.StatusBadRequest, check: wantInvalid("owner_id")},
+	{name: "edit story metadata with wrong type", method: http.MethodPatch, path: "/api/v1/edit-story-metadata/{story}", body: `{"genre":7}`, as: "owner", wantStatus: http.StatusBadRequest, check: wantInvalid("genre")},
+	{name: "edit story metadata with short description", method: http.MethodPatch, path: "/api/v1/edit-story-metadata/{story}", body: `{"description":"Short"}`, as: "owner", wantStatus: http.StatusBadRequest, check: wantInvalid("description")},
+	{name: "edit missing story metadata", method: http.MethodPatch, path: "/api/v1/edit-story-metadata/{missing}", body: `{"title":"Dragon Highway"}`, as: "owner", wantStatus: http.StatusNotFound},
+
+	{name: "create chapter as collaborator", method: http.MethodPost, path: "/api/v1/create-chapter", body: `{"story_id":"{story}","title":"Prologue","content":"Long ago."}`, as: "editor", wantStatus: http.StatusCreated, wantMessage: "Chapter created successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			chapters, _ := f.db.GetChapters(t.Context(), f.story)
+			if len(chapters) != 2 || chapters[0].Title != "Chapter 1" {
+				t.Errorf("existing content was not kept as a leading chapter: %v", chapters)
+			}
+		}},
+	{name: "create chapter without title", method: http.MethodPost, path: "/api/v1/create-chapter", body: `{"story_id":"{chaptered}"}`, as: "owner", wantStatus: http.StatusBadRequest, wantMessage: "Validation failed", check: wantInvalid("title")},
+	{name: "create chapter as viewer", method: http.MethodPost, path: "/api/v1/create-chapter", body: `{"story_id":"{story}","title":"Prologue"}`, as: "viewer", wantStatus: http.StatusForbidden},
+
+	{name: "get chapters", method: http.MethodGet, path: "/api/v1/get-chapters/{chaptered}", wantStatus: http.StatusOK, wantMessage: "Chapters found", check: wantCount("chapters", 1)},
+	{name: "get chapter", method: http.MethodGet, path: "/api/v1/get-chapter/{chaptered}/{chapter}", wantStatus: http.StatusOK, wantMessage: "Chapter found",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if content := body["chapter"].(map[string]any)["content"]; content != "The ship left at dawn." {
+				t.Errorf("content = %v", content)
+			}
+		}},
+	{name: "get missing chapter", method: http.MethodGet, path: "/api/v1/get-chapter/{chaptered}/{missing}", wantStatus: http.StatusNotFound, wantMessage: "Chapter not found"},
+
+	{name: "edit chapter", method: http.MethodPatch, path: "/api/v1/edit-chapter", body: `{"story_id":"{chaptered}","chapter_id":"{chapter}","content":"The ship sank."}`, as: "owner", wantStatus: http.StatusOK, wantMessage: "Chapter updated successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if content := contentOf(t, f, f.chaptered); content != "Harbor\n\nThe ship sank." {
+				t.Errorf("content = %q", content)
+			}
+		}},
+	{name: "edit chapter as stranger", method: http.MethodPatch, path: "/api/v1/edit-chapter", body: `{"story_id":"{chaptered}","chapter_id":"{chapter}","content":"The ship sank."}`, as: "stranger", wantStatus: http.StatusForbidden},
+
+	{name: "delete chapter", method: http.MethodDelete, path: "/api/v1/delete-chapter/{chaptered}/{chapter}", as: "owner", wantStatus: http.StatusOK, wantMessage: "Chapter deleted successfully"},
+	{name: "delete chapter as stranger", method: http.MethodDelete, path: "/api/v1/delete-chapter/{chaptered}/{chapter}", as: "stranger", wantStatus: http.StatusForbidden},
+	{name: "delete missing chapter", method: http.MethodDelete, path: "/api/v1/delete-chapter/{chaptered}/{missing}", as: "owner", wantStatus: http.StatusNotFound},
+
+	{name: "reorder chapters", method: http.MethodPatch, path: "/api/v1/reorder-chapters", body: `{"story_id":"{chaptered}","chapter_ids":["{chapter}"]}`, as: "owner", wantStatus: http.StatusOK, wantMessage: "Chapters reordered successfully"},
+	{name: "reorder chapters with missing ones", method: http.MethodPatch, path: "/api/v1/reorder-chapters", body: `{"story_id":"{chaptered}","chapter_ids":[]}`, as: "owner", wantStatus: http.StatusBadRequest},
+
+	// Revisions
+	{name: "get story revisions", method: http.MethodPost, path: "/api/v1/get-story-revisions", body: `{"story_id":"{story}"}`, wantStatus: http.StatusOK, wantMessage: "Revisions found", check: wantCount("revisions", 2)},
+	{name: "get draft revisions anonymously", method: http.MethodPost, path: "/api/v1/get-story-revisions", body: `{"story_id":"{draft}"}`, wantStatus: http.StatusNotFound},
+	{name: "get story revision", method: http.MethodGet, path: "/api/v1/get-story-revision/{story}/{revision}", wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if content := body["revision"].(map[string]any)["content"]; content != "Once upon a time." {
+				t.Errorf("content = %v", content)
+			}
+		}},
+	{name: "get missing story revision", method: http.MethodGet, path: "/api/v1/get-story-revision/{story}/{missing}", wantStatus: http.StatusNotFound, wantMessage: "Revision not found"},
+
+	{name: "restore revision as collaborator", method: http.MethodPost, path: "/api/v1/restore-story-revision", body: `{"story_id":"{story}","revision_id":"{revision}"}`, as: "editor", wantStatus: http.StatusOK, wantMessage: "Revision restored successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if content := contentOf(t, f, f.story); content != "Once upon a time." {
+				t.Errorf("content = %q", content)
+			}
+		}},
+	{name: "restore revision as viewer", method: http.MethodPost, path: "/api/v1/restore-story-revision", body: `{"story_id":"{story}","revision_id":"{revision}"}`, as: "viewer", wantStatus: http.StatusForbidden},
+	{name: "restore missing revision", method: http.MethodPost, path: "/api/v1/restore-story-revision", body: `{"story_id":"{story}","revision_id":"{missing}"}`, as: "owner", wantStatus: http.StatusNotFound, wantMessage: "Revision not found"},
+
+	{name: "diff story", method: http.MethodGet, path: "/api/v1/diff-story/{story}?from={revision}&granularity=word", wantStatus: http.StatusOK, wantMessage: "Diff computed", check: wantCount("hunks", 1)},
+	{name: "diff story as text", method: http.MethodGet, path: "/api/v1/diff-story/{story}?from={revision}&format=text", wantStatus: http.StatusOK},
+	{name: "diff story without from", method: http.MethodGet, path: "/api/v1/diff-story/{story}", wantStatus: http.StatusBadRequest, wantMessage: "Missing from revision"},
+
+	// Visibility and publishing
+	{name: "set story visibility", method: http.MethodPatch, path: "/api/v1/set-story-visibility", body: `{"story_id":"{story}","visibility":"private"}`, as: "owner", wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if visibility := storyOf(t, f, f.story).Visibility; visibility != data.VisibilityPrivate {
+				t.Errorf("visibility = %q", visibility)
+			}
+		}},
+	{name: "set story visibility as collaborator", method: http.MethodPatch, path: "/api/v1/set-story-visibility", body: `{"story_id":"{story}","visibility":"private"}`, as: "editor", wantStatus: http.StatusForbidden},
+	{name: "set invalid story visibility", method: http.MethodPatch, path: "/api/v1/set-story-visibility", body: `{"story_id":"{story}","visibility":"secret"}`, as: "owner", wantStatus: http.StatusBadRequest},
+
+	{name: "publish story", method: http.MethodPost, path: "/api/v1/publish-story", body: `{"story_id":"{draft}"}`, as: "owner", wantStatus: http.StatusOK, wantMessage: "Story published successfully"},
+	{name: "publish story as stranger", method: http.MethodPost, path: "/api/v1/publish-story", body: `{"story_id":"{draft}"}`, as: "stranger", wantStatus: http.StatusForbidden},
+	{name: "schedule story", method: http.MethodPost, path: "/api/v1/publish-story", body: `{"story_id":"{draft}","publish_at":"2999-01-01T00:00:00Z"}`, as: "owner", wantStatus: http.StatusOK, wantMessage: "Story scheduled successfully"},
+	{name: "publish story at a time the clock has passed", method: http.MethodPost, path: "/api/v1/publish-story", body: `{"story_id":"{draft}","publish_at":"2029-06-01T00:00:00Z"}`, as: "owner", wantStatus: http.StatusOK, wantMessage: "Story published successfully"},
+	{name: "schedule published story", method: http.MethodPost, path: "/api/v1/publish-story", body: `{"story_id":"{story}","publish_at":"2999-01-01T00:00:00Z"}`, as: "owner", wantStatus: http.StatusConflict},
+
+	{name: "unpublish story", method: http.MethodPost, path: "/api/v1/unpublish-story", body: `{"story_id":"{story}"}`, as: "owner", wantStatus: http.StatusOK, wantMessage: "Story unpublished successfully"},
+	{name: "archive story", method: http.MethodPost, path: "/api/v1/unpublish-story", body: `{"story_id":"{story}","archive":true}`, as: "owner", wantStatus: http.StatusOK, wantMessage: "Story archived successfully"},
+	{name: "unpublish story as collaborator", method: http.MethodPost, path: "/api/v1/unpublish-story", body: `{"story_id":"{story}"}`, as: "editor", wantStatus: http.StatusForbidden},
+
+	// Forking and deletion
+	{name: "fork story", method: http.MethodGet, path: "/api/v1/fork-story/{story}", as: "stranger", wantStatus: http.StatusCreated, wantMessage: "Story forked successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if count := storyOf(t, f, f.story).ForkCount; count != 1 {
+				t.Errorf("fork count = %d, want 1", count)
+			}
+		}},
+	{name: "fork own story", method: http.MethodGet, path: "/api/v1/fork-story/{story}", as: "owner", wantStatus: http.StatusBadRequest, wantMessage: "Cannot fork your own story"},
+	{name: "fork story twice", method: http.MethodGet, path: "/api/v1/fork-story/{story}", as: "stranger", setup: withFork, wantStatus: http.StatusConflict, wantMessage: "You have already forked this story"},
+	{name: "fork story again after trashing the fork", method: http.MethodGet, path: "/api/v1/fork-story/{story}", as: "stranger", setup: trashed(withFork, theFork), wantStatus: http.StatusCreated},
+	{name: "fork hidden draft", method: http.MethodGet, path: "/api/v1/fork-story/{draft}", as: "stranger", wantStatus: http.StatusNotFound},
+	{name: "fork story anonymously", method: http.MethodGet, path: "/api/v1/fork-story/{story}", wantStatus: http.StatusUnauthorized},
+
+	{name: "story forks", method: http.MethodPost, path: "/api/v1/get-story-forks", body: `{"story_id":"{story}"}`, setup: withFork, wantStatus: http.StatusOK, wantMessage: "Forks found", check: wantCount("forks", 1)},
+	{name: "story forks leave out trashed forks", method: http.MethodPost, path: "/api/v1/get-story-forks", body: `{"story_id":"{story}"}`, setup: trashed(withFork, theFork), wantStatus: http.StatusOK, check: wantCount("forks", 0)},
+	{name: "story forks of hidden draft", method: http.MethodPost, path: "/api/v1/get-story-forks", body: `{"story_id":"{draft}"}`, as: "stranger", wantStatus: http.StatusNotFound},
+	{name: "story forks without story ID", method: http.MethodPost, path: "/api/v1/get-story-forks", body: `{}`, wantStatus: http.StatusBadRequest, check: wantInvalid("story_id")},
+
+	{name: "story ancestors", method: http.MethodGet, path: "/api/v1/get-story-ancestors/{fork}", setup: withFork, wantStatus: http.StatusOK, wantMessage: "Ancestors found",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			ancestors, _ := body["ancestors"].([]any)
+			if len(ancestors) != 1 || ancestors[0].(map[string]any)["id"] != f.story.Hex() {
+				t.Errorf("ancestors = %v, want the forked story", ancestors)
+			}
+		}},
+	{name: "story ancestors of an original", method: http.MethodGet, path: "/api/v1/get-story-ancestors/{story}", wantStatus: http.StatusOK, check: wantCount("ancestors", 0)},
+	{name: "story ancestors stop at a hidden story", method: http.MethodGet, path: "/api/v1/get-story-ancestors/{fork}", as: "stranger", wantStatus: http.StatusOK, check: wantCount("ancestors", 0),
+		setup: func(t *testing.T, f *fixture) {
+			withFork(t, f)
+			_, err := f.db.SetStoryVisibility(t.Context(), f.story, data.VisibilityPrivate)
+			mustSeed(t, err)
+		}},
+
+	{name: "fork tree", method: http.MethodGet, path: "/api/v1/get-fork-tree/{story}", setup: withForkChain, wantStatus: http.StatusOK, wantMessage: "Fork tree found",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			tree, _ := body["tree"].(map[string]any)
+			forks := itemCount(t, tree, "forks")
+			if forks != 1 {
+				t.Fatalf("tree has %d forks, want 1", forks)
+			}
+			if grandforks := itemCount(t, tree["forks"].([]any)[0].(map[string]any), "forks"); grandforks != 1 {
+				t.Errorf("fork has %d forks, want 1", grandforks)
+			}
+		}},
+	{name: "fork tree with depth", method: http.MethodGet, path: "/api/v1/get-fork-tree/{story}?depth=1", setup: withForkChain, wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			fork := body["tree"].(map[string]any)["forks"].([]any)[0].(map[string]any)
+			if itemCount(t, fork, "forks") != 0 || fork["truncated"] != true {
+				t.Errorf("fork = %v, want it truncated without forks", fork)
+			}
+		}},
+	{name: "fork tree with depth ignores private forks", method: http.MethodGet, path: "/api/v1/get-fork-tree/{story}?depth=1", wantStatus: http.StatusOK,
+		setup: func(t *testing.T, f *fixture) {
+			withFork(t, f)
+			grandfork, err := f.db.ForkStory(t.Context(), f.fork, f.users["invitee"])
+			mustSeed(t, err)
+			_, err = f.db.SetStoryVisibility(t.Context(), grandfork, data.VisibilityPrivate)
+			mustSeed(t, err)
+		},
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			fork := body["tree"].(map[string]any)["forks"].([]any)[0].(map[string]any)
+			if fork["truncated"] != nil {
+				t.Errorf("fork = %v, want it not truncated", fork)
+			}
+		}},
+	{name: "fork tree with invalid depth", method: http.MethodGet, path: "/api/v1/get-fork-tree/{story}?depth=0", wantStatus: http.StatusBadRequest},
+	{name: "fork tree of hidden draft", method: http.MethodGet, path: "/api/v1/get-fork-tree/{draft}", as: "stranger", wantStatus: http.StatusNotFound},
+
+	// Merge requests
+	{name: "create merge request", method: http.MethodPost, path: "/api/v1/create-merge-request", body: `{"fork_id":"{fork}","title":"Add fire"}`, as: "stranger", wantStatus: http.StatusCreated, wantMessage: "Merge request created",
+		setup: func(t *testing.T, f *fixture) {
+			withFork(t, f)
+			_, err := f.db.EditStoryContent(t.Context(), f.fork, f.users["stranger"], mergedContent)
+			mustSeed(t, err)
+		},
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			id, _ := primitive.ObjectIDFromHex(body["merge_request_id"].(string))
+			request, err := f.db.GetMergeRequest(t.Context(), id)
+			if err != nil {
+				t.Fatalf("fetching merge request: %v", err)
+			}
+			if request.StoryID != f.story || request.Content != mergedContent || request.Status != data.MergeRequestOpen {
+				t.Errorf("merge request = %+v, want the fork's content proposed to story", request)
+			}
+		}},
+	{name: "create merge request without changes", method: http.MethodPost, path: "/api/v1/create-merge-request", body: `{"fork_id":"{fork}","title":"Nothing new"}`, as: "stranger", setup: withFork, wantStatus: http.StatusBadRequest, wantMessage: "Fork has no changes to merge"},
+	{name: "create second open merge request", method: http.MethodPost, path: "/api/v1/create-merge-request", body: `{"fork_id":"{fork}","title":"Add fire again"}`, as: "stranger", setup: withMergeRequest, wantStatus: http.StatusConflict},
+	{name: "create merge request from an original", method: http.MethodPost, path: "/api/v1/create-merge-request", body: `{"fork_id":"{story}","title":"Not a fork"}`, as: "owner", wantStatus: http.StatusBadRequest, wantMessage: "Story is not a fork"},
+	{name: "create merge request from another user's fork", method: http.MethodPost, path: "/api/v1/create-merge-request", body: `{"fork_id":"{fork}","title":"Add fire"}`, as: "owner", setup: withFork, wantStatus: http.StatusForbidden},
+	{name: "create merge request without title", method: http.MethodPost, path: "/api/v1/create-merge-request", body: `{"fork_id":"{fork}"}`, as: "stranger", setup: withFork, wantStatus: http.StatusBadRequest, check: wantInvalid("title")},
+
+	{name: "merge requests", method: http.MethodPost, path: "/api/v1/get-merge-requests", body: `{"story_id":"{story}"}`, setup: withMergeRequest, wantStatus: http.StatusOK, wantMessage: "Merge requests found", check: wantCount("merge_requests", 1)},
+	{name: "merge requests by status", method: http.MethodPost, path: "/api/v1/get-merge-requests", body: `{"story_id":"{story}","status":"accepted"}`, setup: withMergeRequest, wantStatus: http.StatusOK, check: wantCount("merge_requests", 0)},
+	{name: "merge requests with invalid status", method: http.MethodPost, path: "/api/v1/get-merge-requests", body: `{"story_id":"{story}","status":"merged"}`, wantStatus: http.StatusBadRequest, check: wantInvalid("status")},
+
+	{name: "merge request", method: http.MethodGet, path: "/api/v1/get-merge-request/{merge}", setup: withMergeRequest, wantStatus: http.StatusOK, wantMessage: "Merge request found", check: wantCount("hunks", 1)},
+	{name: "merge request to a private story", method: http.MethodGet, path: "/api/v1/get-merge-request/{merge}", as: "invitee", wantStatus: http.StatusNotFound,
+		setup: func(t *testing.T, f *fixture) {
+			withMergeRequest(t, f)
+			_, err := f.db.SetStoryVisibility(t.Context(), f.story, data.VisibilityPrivate)
+			mustSeed(t, err)
+		}},
+	{name: "merge request by an author who lost access", method: http.MethodGet, path: "/api/v1/get-merge-request/{merge}", as: "stranger", wantStatus: http.StatusOK,
+		setup: func(t *testing.T, f *fixture) {
+			withMergeRequest(t, f)
+			_, err := f.db.EditStoryContent(t.Context(), f.story, f.users["owner"], "A secret ending.")
+			mustSeed(t, err)
+			_, err = f.db.SetStoryVisibility(t.Context(), f.story, data.VisibilityPrivate)
+			mustSeed(t, err)
+		},
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			request, _ := f.db.GetMergeRequest(t.Context(), f.mergeRequest)
+			if body["base"] != request.BaseRevisionID.Hex() {
+				t.Errorf("base = %v, want the revision the request was based on", body["base"])
+			}
+			if hunks, _ := json.Marshal(body["hunks"]); strings.Contains(string(hunks), "secret") {
+				t.Errorf("hunks = %s, want nothing written upstream since", hunks)
+			}
+		}},
+	{name: "missing merge request", method: http.MethodGet, path: "/api/v1/get-merge-request/{missing}", wantStatus: http.StatusNotFound},
+
+	{name: "comment on merge request", method: http.MethodPost, path: "/api/v1/comment-merge-request", body: `{"merge_request_id":"{merge}","body":"Lovely."}`, as: "owner", setup: withMergeRequest, wantStatus: http.StatusCreated, wantMessage: "Comment added",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			request, _ := f.db.GetMergeRequest(t.Context(), f.mergeRequest)
+			if len(request.Comments) != 1 || request.Comments[0].AuthorID != f.users["owner"] {
+				t.Errorf("comments = %+v, want the owner's comment", request.Comments)
+			}
+		}},
+	{name: "comment on merge request as viewer", method: http.MethodPost, path: "/api/v1/comment-merge-request", body: `{"merge_request_id":"{merge}","body":"Lovely."}`, as: "viewer", setup: withMergeRequest, wantStatus: http.StatusForbidden},
+
+	{name: "accept merge request", method: http.MethodPost, path: "/api/v1/accept-merge-request/{merge}", as: "owner", setup: withMergeRequest, wantStatus: http.StatusOK, wantMessage: "Merge request accepted",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if content := contentOf(t, f, f.story); content != mergedContent {
+				t.Errorf("content = %q, want the merged content", content)
+			}
+			revisions, _ := f.db.GetStoryRevisions(t.Context(), f.story, data.PageRequest{})
+			if latest := revisions.Items[0]; latest.ID.Hex() != body["revision_id"] || latest.AuthorID != f.users["stranger"] {
+				t.Errorf("latest revision = %+v, want one by the merge request's author", latest)
+			}
+			request, _ := f.db.GetMergeRequest(t.Context(), f.mergeRequest)
+			if request.Status != data.MergeRequestAccepted || request.DecidedBy != f.users["owner"] {
+				t.Errorf("merge request = %+v, want it accepted by owner", request)
+			}
+		}},
+	{name: "accept merge request as collaborator", method: http.MethodPost, path: "/api/v1/accept-merge-request/{merge}", as: "editor", setup: withMergeRequest, wantStatus: http.StatusForbidden},
+
+	{name: "reject merge request", method: http.MethodPost, path: "/api/v1/reject-merge-request/{merge}", as: "owner", setup: withMergeRequest, wantStatus: http.StatusOK, wantMessage: "Merge request rejected",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if content := contentOf(t, f, f.story); content == mergedContent {
+				t.Error("rejecting the merge request changed the story")
+			}
+		}},
+	{name: "accept rejected merge request", method: http.MethodPost, path: "/api/v1/accept-merge-request/{merge}", as: "owner", wantStatus: http.StatusConflict,
+		setup: func(t *testing.T, f *fixture) {
+			withMergeRequest(t, f)
+			_, err := f.db.RejectMergeRequest(t.Context(), f.mergeRequest, f.users["owner"])
+			mustSeed(t, err)
+		}},
+
+	{name: "delete story", method: http.MethodDelete, path: "/api/v1/delete-story/{story}", as: "owner", wantStatus: http.StatusOK, wantMessage: "Story moved to trash",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if _, err := f.db.GetStoryDetails(t.Context(), f.story); err == nil {
+				t.Error("story still exists")
+			}
+			trash, _ := f.db.GetTrash(t.Context(), f.users["owner"], time.Hour, data.PageRequest{})
+			if len(trash.Items) != 1 || trash.Items[0].ID != f.story {
+				t.Errorf("trash = %v, want the deleted story", trash.Items)
+			}
+		}},
+	{name: "delete fork", method: http.MethodDelete, path: "/api/v1/delete-story/{fork}", as: "stranger", setup: withFork, wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if count := storyOf(t, f, f.story).ForkCount; count != 0 {
+				t.Errorf("fork count = %d, want 0", count)
+			}
+		}},
+	{name: "delete trashed story", method: http.MethodDelete, path: "/api/v1/delete-story/{story}", as: "owner", setup: trashed(nil, theStory), wantStatus: http.StatusNotFound},
+	{name: "delete story as collaborator", method: http.MethodDelete, path: "/api/v1/delete-story/{story}", as: "editor", wantStatus: http.StatusForbidden},
+	{name: "delete story as stranger", method: http.MethodDelete, path: "/api/v1/delete-story/{story}", as: "stranger", wantStatus: http.StatusForbidden},
+	{name: "delete missing story", method: http.MethodDelete, path: "/api/v1/delete-story/{missing}", as: "owner", wantStatus: http.StatusNotFound},
+
+	{name: "delete all stories", method: http.MethodDelete, path: "/api/v1/delete-all-stories", as: "owner", wantStatus: http.StatusOK, wantMessage: "Stories moved to trash",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			stories, _ := f.db.GetStoriesByUser(t.Context(), f.users["owner"], true, data.PageRequest{})
+			if len(stories.Items) != 0 {
+				t.Errorf("%d stories left", len(stories.Items))
+			}
+		}},
+	{name: "delete all stories anonymously", method: http.MethodDelete, path: "/api/v1/delete-all-stories", wantStatus: http.StatusUnauthorized},
+
+	// Trash
+	{name: "trash", method: http.MethodPost, path: "/api/v1/trash", body: `{}`, as: "owner", setup: trashed(nil, theStory), wantStatus: http.StatusOK, wantMessage: "Trash found", check: wantCount("stories", 1)},
+	{name: "trash of another user", method: http.MethodPost, path: "/api/v1/trash", body: `{}`, as: "stranger", setup: trashed(nil, theStory), wantStatus: http.StatusOK, check: wantCount("stories", 0)},
+	{name: "trash anonymously", method: http.MethodPost, path: "/api/v1/trash", body: `{}`, wantStatus: http.StatusUnauthorized},
+	{name: "trashed story is not listed", method: http.MethodPost, path: "/api/v1/get-stories", body: `{}`, setup: trashed(nil, theStory), wantStatus: http.StatusOK, check: wantCount("stories", 1)},
+	{name: "trashed story is not readable", method: http.MethodGet, path: "/api/v1/get-story-details/{story}", as: "owner", setup: trashed(nil, theStory), wantStatus: http.StatusNotFound},
+
+	{name: "restore story", method: http.MethodPost, path: "/api/v1/restore-story/{story}", as: "owner", setup: trashed(nil, theStory), wantStatus: http.StatusOK, wantMessage: "Story restored successfully",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if story := storyOf(t, f, f.story); story.Trashed() || len(story.Collaborators) != 2 {
+				t.Errorf("restored story = %+v, want it back as it was", story)
+			}
+		}},
+	{name: "restore fork", method: http.MethodPost, path: "/api/v1/restore-story/{fork}", as: "stranger", setup: trashed(withFork, theFork), wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if count := storyOf(t, f, f.story).ForkCount; count != 1 {
+				t.Errorf("fork count = %d, want 1", count)
+			}
+		}},
+	{name: "restore fork after forking again", method: http.MethodPost, path: "/api/v1/restore-story/{fork}", as: "stranger", wantStatus: http.StatusConflict,
+		setup: func(t *testing.T, f *fixture) {
+			trashed(withFork, theFork)(t, f)
+			_, err := f.db.ForkStory(t.Context(), f.story, f.users["stranger"])
+			mustSeed(t, err)
+		}},
+	{name: "restore story as collaborator", method: http.MethodPost, path: "/api/v1/restore-story/{story}", as: "editor", setup: trashed(nil, theStory), wantStatus: http.StatusNotFound, wantMessage: "Story not found in trash"},
+	{name: "restore live story", method: http.MethodPost, path: "/api/v1/restore-story/{story}", as: "owner", wantStatus: http.StatusNotFound, wantMessage: "Story not found in trash"},
+	{name: "restore scheduled draft", method: http.MethodPost, path: "/api/v1/restore-story/{draft}", as: "owner", wantStatus: http.StatusOK,
+		setup: func(t *testing.T, f *fixture) {
+			_, err := f.db.ScheduleStory(t.Context(), f.draft, time.Now().Add(-time.Minute))
+			mustSeed(t, err)
+			trashed(nil, func(f *fixture) primitive.ObjectID { return f.draft })(t, f)
+			_, err = f.db.PublishScheduledStories(t.Context())
+			mustSeed(t, err)
+		},
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if status := storyOf(t, f, f.draft).Status; status != data.StatusDraft {
+				t.Errorf("status = %s, want the draft not published while in the trash", status)
+			}
+		}},
+	{name: "restore purged story", method: http.MethodPost, path: "/api/v1/restore-story/{story}", as: "owner", wantStatus: http.StatusNotFound,
+		setup: func(t *testing.T, f *fixture) {
+			trashed(nil, theStory)(t, f)
+			purged, err := f.db.PurgeTrash(t.Context(), 0)
+			mustSeed(t, err)
+			if purged != 1 {
+				t.Fatalf("purged %d stories, want 1", purged)
+			}
+		},
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if revisions, err := f.db.GetStoryRevisions(t.Context(), f.story, data.PageRequest{}); err == nil && len(revisions.Items) > 0 {
+				t.Errorf("%d revisions left after purging", len(revisions.Items))
+			}
+		}},
+
+	// Admin
+	{name: "cleanup dry run", method: http.MethodPost, path: "/api/v1/admin/cleanup", body: `{"dry_run":true}`, as: "admin", setup: withOrphans(1), wantStatus: http.StatusOK, wantMessage: "Cleanup finished",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			report, _ := body["report"].(map[string]any)
+			if report["dry_run"] != true || itemCount(t, report, "stories") != 1 || itemCount(t, report, "collaborator_removals") != 1 {
+				t.Errorf("report = %v, want a dry run listing one story and one collaborator", report)
+			}
+			storyOf(t, f, f.orphans[0])
+			if invitations := storyOf(t, f, f.story).Invitations; len(invitations) != 2 {
+				t.Errorf("%d invitations left, want 2", len(invitations))
+			}
+		}},
+	{name: "cleanup", method: http.MethodPost, path: "/api/v1/admin/cleanup", as: "admin", setup: withOrphans(1), wantStatus: http.StatusOK, wantMessage: "Cleanup finished",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if _, err := f.db.GetStoryDetails(t.Context(), f.orphans[0]); err == nil {
+				t.Error("orphaned story still exists")
+			}
+			if invitations := storyOf(t, f, f.story).Invitations; len(invitations) != 1 {
+				t.Errorf("%d invitations left, want 1", len(invitations))
+			}
+			if report := f.db.LastCleanupReport(); report == nil || report.DryRun || report.OwnersChecked != 2 {
+				t.Errorf("last report = %+v, want a real run over two owners", report)
+			}
+		}},
+	{name: "cleanup over threshold", method: http.MethodPost, path: "/api/v1/admin/cleanup", as: "admin", setup: withOrphans(2), wantStatus: http.StatusOK, wantMessage: "Cleanup aborted",
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			for _, id := range f.orphans {
+				storyOf(t, f, id)
+			}
+		}},
+	{name: "cleanup as non-admin", method: http.MethodPost, path: "/api/v1/admin/cleanup", as: "owner", setup: withOrphans(1), wantStatus: http.StatusForbidden,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			storyOf(t, f, f.orphans[0])
+		}},
+	{name: "cleanup report", method: http.MethodGet, path: "/api/v1/admin/cleanup", as: "admin", wantStatus: http.StatusOK, wantMessage: "Cleanup report found",
+		setup: func(t *testing.T, f *fixture) {
+			_, err := f.db.CleanupOrphanedStories(t.Context(), database.CleanupOptions{DryRun: true})
+			mustSeed(t, err)
+		}},
+	{name: "cleanup report before any run", method: http.MethodGet, path: "/api/v1/admin/cleanup", as: "admin", wantStatus: http.StatusNotFound, wantMessage: "No cleanup has run yet"},
+	{name: "cleanup report anonymously", method: http.MethodGet, path: "/api/v1/admin/cleanup", wantStatus: http.StatusUnauthorized},
+
+	// Misc
+	{name: "health", method: http.MethodGet, path: "/api/v1/health", wantStatus: http.StatusOK,
+		check: func(t *testing.T, f *fixture, body map[string]any) {
+			if body["status"] != "ok" {
+				t.Errorf("status = %v", body["status"])
+			}
+		}},
+	{name: "root redirects", method: http.MethodGet, path: "/", wantStatus: http.StatusMovedPermanently},
+	{name: "unknown route", method: http.MethodGet, path: "/api/v1/nope", wantStatus: http.StatusNotFound, wantMessage: "Not found"},
+}
+
+func TestRoutes(t *testing.T) {
+	for _, tt := range routeTests {
+		t.Run(tt.name, tt.run)
+	}
+}
+
+// TestRoutesAreCovered fails when a route is registered without a test case.
+func TestRoutesAreCovered(t *testing.T) {
+	_, handler := New(Config{JWTSecret: []byte(testSecret)}, database.NewMemory(nil), nil, nil)
+	e := handler.(*echo.Echo)
+	for _, route := range e.Routes() {
+		if route.Method == echo.RouteNotFound {
+			continue
+		}
+		covered := false
+		for _, tt := range routeTests {
+			if tt.method == route.Method && matchesRoute(route.Path, tt.path) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			t.Errorf("no test case for %s %s", route.Method, route.Path)
+		}
+	}
+}
+
+// matchesRoute reports whether path, with its query stripped, fits an echo
+// route pattern.
+func matchesRoute(pattern, path string) bool {
+	path, _, _ = strings.Cut(path, "?")
+	want, got := strings.Split(pattern, "/"), strings.Split(path, "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if !strings.HasPrefix(want[i], ":") && want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
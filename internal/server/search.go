@@ -0,0 +1,42 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/database"
+	"github.com/mAmineChniti/StoryHub/internal/search"
+)
+
+func (s *Server) SearchStories(c echo.Context) error {
+	var request data.SearchRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	request.Query = strings.TrimSpace(request.Query)
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	results, err := s.search.Search(c.Request().Context(), search.Query{
+		Text:   request.Query,
+		Genres: request.Genres,
+		Cursor: request.Cursor,
+		Limit:  database.PageLimit(request.Limit),
+	})
+	if errors.Is(err, search.ErrInvalidCursor) {
+		return database.ErrInvalidCursor
+	}
+	if err != nil {
+		return err
+	}
+	page := &data.Page[search.Hit]{Items: results.Hits, NextCursor: results.NextCursor, PrevCursor: results.PrevCursor}
+	if request.WithTotal {
+		total := int64(results.Total)
+		page.Total = &total
+	}
+	return c.JSON(http.StatusOK, pageResponse("Stories found", "results", page))
+}
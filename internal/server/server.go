@@ -3,37 +3,80 @@ package server
 import (
 	"fmt"
 	"net/http"
-	"os"
-	"strconv"
 	"time"
 
-	_ "github.com/joho/godotenv/autoload"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/mAmineChniti/StoryHub/internal/database"
+	"github.com/mAmineChniti/StoryHub/internal/search"
 )
 
+// Config holds the server's settings, usually taken from a config.Config.
+type Config struct {
+	Port      int
+	JWTSecret []byte
+	// Debug logs every request and response body.
+	Debug bool
+	// EditorsEditMetadata lets editors change a story's title, genre and
+	// description, which otherwise only its owner can.
+	EditorsEditMetadata bool
+	// Admins are the users allowed to use the admin endpoints.
+	Admins []primitive.ObjectID
+	// Cleanup is used for orphan cleanup runs started from the admin
+	// endpoint. A run may still ask for a dry run.
+	Cleanup database.CleanupOptions
+	// TrashRetention is how long deleted stories can be restored.
+	TrashRetention time.Duration
+}
+
+// Clock tells the server what time it is. It only affects checks made in the
+// handlers, such as whether a publish time has already passed; the database
+// layer stamps and compares times with time.Now.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock backed by time.Now.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
 type Server struct {
-	port int
+	config Config
+	clock  Clock
+	logger echo.Logger
 
-	db database.Service
+	db     database.Service
+	search search.Engine
 }
 
-func NewServer() *http.Server {
-	envPort := os.Getenv("PORT")
-	if envPort == "" {
-		envPort = "8080"
+// New builds a Server around its dependencies and returns it along with the
+// handler serving its routes. A nil clock falls back to SystemClock and a nil
+// logger to echo's own.
+func New(config Config, db database.Service, clock Clock, logger echo.Logger) (*Server, http.Handler) {
+	if clock == nil {
+		clock = SystemClock{}
 	}
-	port, _ := strconv.Atoi(envPort)
-	NewServer := &Server{
-		port: port,
+	s := &Server{
+		config: config,
+		clock:  clock,
+		logger: logger,
 
-		db: database.New(),
+		db:     db,
+		search: database.NewSearchEngine(db),
 	}
+	return s, s.RegisterRoutes()
+}
 
+// NewHTTPServer wraps handler in an http.Server listening on config.Port.
+func NewHTTPServer(config Config, handler http.Handler) *http.Server {
 	// Declare Server config
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", NewServer.port),
-		Handler:      NewServer.RegisterRoutes(),
+		Addr:         fmt.Sprintf(":%d", config.Port),
+		Handler:      handler,
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
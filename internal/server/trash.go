@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/data"
+	"github.com/mAmineChniti/StoryHub/internal/policy"
+)
+
+// GetTrash lists the caller's deleted stories that can still be restored.
+func (s *Server) GetTrash(c echo.Context) error {
+	var request data.PageRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return err
+	}
+	userId := c.Get("user_id").(primitive.ObjectID)
+	stories, err := s.db.GetTrash(c.Request().Context(), userId, s.config.TrashRetention, request)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pageResponse("Trash found", "stories", stories))
+}
+
+// RestoreStory takes one of the caller's stories out of the trash. Stories
+// deleted longer ago than the retention period are gone for good.
+func (s *Server) RestoreStory(c echo.Context) error {
+	storyId, err := primitive.ObjectIDFromHex(c.Param("story_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid story ID")
+	}
+	story, err := s.db.GetTrashedStory(c.Request().Context(), storyId, s.config.TrashRetention)
+	if err != nil {
+		return err
+	}
+	userId, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	// Someone else's trash is none of the caller's business.
+	if !policy.Can(story, userId, policy.RestoreStory) {
+		return echo.NewHTTPError(http.StatusNotFound, "Story not found in trash")
+	}
+	restored, err := s.db.RestoreStory(c.Request().Context(), storyId, s.config.TrashRetention)
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to restore story")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Story restored successfully"})
+}
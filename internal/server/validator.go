@@ -0,0 +1,27 @@
+package server
+
+import (
+	"github.com/mAmineChniti/StoryHub/internal/data"
+)
+
+// requestValidator is the echo.Validator behind c.Validate. Handlers call it
+// on every request body right after binding.
+type requestValidator struct{}
+
+func (requestValidator) Validate(i any) error {
+	fields, err := data.ValidateStruct(i)
+	if fields != nil {
+		return &validationError{fields: fields}
+	}
+	return err
+}
+
+// validationError lists the invalid fields of a request body, keyed by their
+// JSON names. It is answered with a 400 and the fields as details.
+type validationError struct {
+	fields map[string]string
+}
+
+func (e *validationError) Error() string {
+	return "validation failed"
+}
@@ -0,0 +1,110 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/config"
+)
+
+// HTTPDirectory is a Directory backed by the user service's batch lookup
+// endpoint. Each batch is one request:
+//
+//	POST {base URL}/users/lookup
+//	Authorization: Bearer {service token}
+//	{"user_ids": ["...", "..."]}
+//
+// answered with the IDs the service knows to exist and to be gone:
+//
+//	{"existing": ["..."], "missing": ["..."]}
+//
+// IDs in neither list are left out of the result.
+type HTTPDirectory struct {
+	lookupURL string
+	token     string
+	batchSize int
+	client    *http.Client
+}
+
+func NewHTTPDirectory(cfg config.Users) *HTTPDirectory {
+	return &HTTPDirectory{
+		lookupURL: strings.TrimSuffix(cfg.BaseURL, "/") + "/users/lookup",
+		token:     cfg.ServiceToken,
+		batchSize: max(cfg.BatchSize, 1),
+		client:    &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+type lookupRequest struct {
+	UserIDs []primitive.ObjectID `json:"user_ids"`
+}
+
+type lookupResponse struct {
+	Existing []primitive.ObjectID `json:"existing"`
+	Missing  []primitive.ObjectID `json:"missing"`
+}
+
+// Lookup asks the user service about ids, batchSize at a time. A batch that
+// fails fails the whole lookup.
+func (d *HTTPDirectory) Lookup(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	found := make(map[primitive.ObjectID]bool, len(ids))
+	for batch := range slices.Chunk(ids, d.batchSize) {
+		response, err := d.lookup(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		// Only answers about IDs that were asked for are recorded, and a
+		// user listed as both existing and missing is taken to exist.
+		for _, id := range response.Missing {
+			if slices.Contains(batch, id) {
+				found[id] = false
+			}
+		}
+		for _, id := range response.Existing {
+			if slices.Contains(batch, id) {
+				found[id] = true
+			}
+		}
+	}
+	return found, nil
+}
+
+func (d *HTTPDirectory) lookup(ctx context.Context, ids []primitive.ObjectID) (*lookupResponse, error) {
+	body, err := json.Marshal(lookupRequest{UserIDs: ids})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling lookup request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.lookupURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating lookup request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up users: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Drain a little of the body so the connection can be reused.
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("user service answered the lookup with status %d", resp.StatusCode)
+	}
+	var response lookupResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding lookup response: %v", err)
+	}
+	return &response, nil
+}
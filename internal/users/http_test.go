@@ -0,0 +1,71 @@
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/config"
+)
+
+func TestHTTPDirectoryLookup(t *testing.T) {
+	alive, gone, unknown := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	var batches [][]primitive.ObjectID
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/users/lookup" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer service-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var request lookupRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, request.UserIDs)
+
+		var response lookupResponse
+		for _, id := range request.UserIDs {
+			switch id {
+			case alive:
+				response.Existing = append(response.Existing, id)
+			case gone:
+				response.Missing = append(response.Missing, id)
+			}
+		}
+		// Answers about users nobody asked for are ignored.
+		response.Missing = append(response.Missing, primitive.NewObjectID())
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer service.Close()
+
+	cfg := config.Users{BaseURL: service.URL + "/api/v1/", ServiceToken: "service-token", BatchSize: 2, Timeout: time.Second}
+	found, err := NewHTTPDirectory(cfg).Lookup(t.Context(), []primitive.ObjectID{alive, gone, unknown})
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Errorf("batches = %v, want sizes 2 and 1", batches)
+	}
+	want := map[primitive.ObjectID]bool{alive: true, gone: false}
+	if len(found) != len(want) || found[alive] != true || found[gone] != false {
+		t.Errorf("Lookup() = %v, want %v", found, want)
+	}
+	if _, ok := found[unknown]; ok {
+		t.Errorf("Lookup() answered for a user the service did not know")
+	}
+
+	cfg.ServiceToken = "wrong"
+	if _, err := NewHTTPDirectory(cfg).Lookup(t.Context(), []primitive.ObjectID{alive}); err == nil {
+		t.Errorf("Lookup() with a rejected token succeeded")
+	}
+}
@@ -0,0 +1,30 @@
+package users
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StaticDirectory is a Directory that knows a fixed set of users, for tests
+// and local development without the user service. Every user outside the set
+// is reported as deleted.
+type StaticDirectory struct {
+	existing map[primitive.ObjectID]bool
+}
+
+func NewStaticDirectory(existing ...primitive.ObjectID) *StaticDirectory {
+	d := &StaticDirectory{existing: make(map[primitive.ObjectID]bool, len(existing))}
+	for _, id := range existing {
+		d.existing[id] = true
+	}
+	return d
+}
+
+func (d *StaticDirectory) Lookup(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	found := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		found[id] = d.existing[id]
+	}
+	return found, nil
+}
@@ -0,0 +1,40 @@
+// Package users tells StoryHub which users still exist. Accounts live in a
+// separate user service; orphan cleanup asks a Directory about story owners
+// before removing anything of theirs.
+package users
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mAmineChniti/StoryHub/internal/config"
+)
+
+// Directory looks users up by ID.
+type Directory interface {
+	// Lookup reports, for each of ids it could resolve, whether that user
+	// exists. IDs it has no answer for are left out of the map, so callers
+	// never mistake an unreachable user for a deleted one.
+	Lookup(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error)
+}
+
+// New returns the Directory selected by cfg.Driver.
+func New(cfg config.Users) (Directory, error) {
+	switch cfg.Driver {
+	case config.DriverHTTP:
+		return NewHTTPDirectory(cfg), nil
+	case config.DriverStatic:
+		existing := make([]primitive.ObjectID, 0, len(cfg.Existing))
+		for _, hex := range cfg.Existing {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid user ID %q: %v", hex, err)
+			}
+			existing = append(existing, id)
+		}
+		return NewStaticDirectory(existing...), nil
+	}
+	return nil, fmt.Errorf("unknown user directory driver %q", cfg.Driver)
+}